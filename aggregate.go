@@ -0,0 +1,379 @@
+package dynamoDao
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	aggregateCount = "count"
+	aggregateSum   = "sum"
+	aggregateMin   = "min"
+	aggregateMax   = "max"
+	aggregateAvg   = "avg"
+)
+
+var (
+	listIndexRegex = regexp.MustCompile("\\d+")
+)
+
+// Aggregation is a value computed over the items of a search by AggregateQuery, AggregateScan or
+// QueryBuilder.Aggregate.  The items are read a page at a time and only the attributes the aggregations and group by
+// fields need are read, the items themselves are never unmarshaled.
+type Aggregation struct {
+	function string
+	field    string
+}
+
+// Counts the items.  When it is the only aggregation and there is no group by, DynamoDB counts the items and none are
+// read at all.
+func Count() Aggregation {
+	return Aggregation{function: aggregateCount}
+}
+
+// Sums the numeric field.  Items without the field are skipped.
+func Sum(field string) Aggregation {
+	return Aggregation{function: aggregateSum, field: field}
+}
+
+// The smallest value of the numeric field, NaN if no item has it.
+func Min(field string) Aggregation {
+	return Aggregation{function: aggregateMin, field: field}
+}
+
+// The largest value of the numeric field, NaN if no item has it.
+func Max(field string) Aggregation {
+	return Aggregation{function: aggregateMax, field: field}
+}
+
+// The average value of the numeric field over the items that have it, NaN if none do.
+func Avg(field string) Aggregation {
+	return Aggregation{function: aggregateAvg, field: field}
+}
+
+// AggregateGroup holds the results of the aggregations for a group of items, in the order the aggregations were given.
+// Key holds the values of the group by fields, nil where the items do not have the field, and is empty when there is
+// no group by.  Numbers are summed as float64s so very large integers may lose precision.
+type AggregateGroup struct {
+	Key    []interface{}
+	Values []float64
+}
+
+type aggregateState struct {
+	group  *AggregateGroup
+	counts []int64
+}
+
+// Computes the aggregations over the items matching the query, grouped by the values of the groupBy fields.  The
+// expressions and values are the same as those of PagedQuery.  The groups are returned in the order their first item
+// was read.  Without groupBy a single group is returned, even if no items match.  The ConsistentRead option is
+// honoured, projection options are ignored.
+func (dao *DynamoDBDao) AggregateQuery(indexName, keyExpression, filterExpression string,
+	queryValues map[string]interface{}, groupBy []string, aggregations []Aggregation,
+	opts ...ReadOption) ([]*AggregateGroup, error) {
+	if keyExpression == "" {
+		return nil, errors.New("aggregate: a key expression is required to query")
+	}
+	return dao.aggregate(indexName, keyExpression, filterExpression, queryValues, groupBy, aggregations, opts)
+}
+
+// Computes the aggregations over the items of the index, or table if the index name is empty, matching the filter
+// expression.  See AggregateQuery.
+func (dao *DynamoDBDao) AggregateScan(indexName, filterExpression string, queryValues map[string]interface{},
+	groupBy []string, aggregations []Aggregation, opts ...ReadOption) ([]*AggregateGroup, error) {
+	return dao.aggregate(indexName, "", filterExpression, queryValues, groupBy, aggregations, opts)
+}
+
+// Groups the items of the query by the values of the given fields when they are aggregated.
+func (qb *QueryBuilder) GroupBy(fields ...string) *QueryBuilder {
+	qb.groupBy = append(qb.groupBy, fields...)
+	return qb
+}
+
+// Validates the query and computes the aggregations over all of its items.  See AggregateQuery.
+func (qb *QueryBuilder) Aggregate(aggregations ...Aggregation) ([]*AggregateGroup, error) {
+	indexName, keyExpression, filterExpression, queryValues, err := qb.Build()
+	if err != nil {
+		return nil, err
+	}
+	return qb.dao.AggregateQuery(indexName, keyExpression, filterExpression, queryValues, qb.groupBy, aggregations,
+		qb.options...)
+}
+
+func (dao *DynamoDBDao) aggregate(indexName, keyExpression, filterExpression string, queryValues map[string]interface{},
+	groupBy []string, aggregations []Aggregation, opts []ReadOption) ([]*AggregateGroup, error) {
+	if len(aggregations) == 0 {
+		return nil, errors.New("aggregate: at least one aggregation is required")
+	}
+	attrPaths := make([]string, 0, len(groupBy)+len(aggregations))
+	groupByPaths := make([]string, len(groupBy))
+	for i, field := range groupBy {
+		attrPath, err := dao.resolveAttributeName(field)
+		if err != nil {
+			return nil, errors.New("aggregate: " + err.Error())
+		}
+		groupByPaths[i] = attrPath
+		attrPaths = append(attrPaths, attrPath)
+	}
+	fieldPaths := make([]string, len(aggregations))
+	for i, aggregation := range aggregations {
+		if aggregation.function == aggregateCount {
+			continue
+		}
+		attrPath, err := dao.resolveAttributeName(aggregation.field)
+		if err != nil {
+			return nil, errors.New("aggregate: " + err.Error())
+		}
+		fieldPaths[i] = attrPath
+		attrPaths = append(attrPaths, attrPath)
+	}
+	groups := make([]*aggregateState, 0, 1)
+	groupsByKey := make(map[string]*aggregateState)
+	if len(groupBy) == 0 {
+		groups = append(groups, newAggregateState(nil, len(aggregations)))
+	}
+	err := dao.streamItems(indexName, keyExpression, filterExpression, queryValues, attrPaths, newReadOptions(opts),
+		func(items []map[string]*dynamodb.AttributeValue, count int64) error {
+			if items == nil {
+				// Only items are being counted, which DynamoDB did for us.
+				for i := range aggregations {
+					groups[0].group.Values[i] += float64(count)
+				}
+				return nil
+			}
+			for _, item := range items {
+				// Items are grouped by their values as they would be without tenants.
+				item, err := dao.unscopeAttributes(item)
+				if err != nil {
+					return err
+				}
+				state, err := groupFor(item, groupByPaths, len(aggregations), groupsByKey, &groups)
+				if err != nil {
+					return err
+				}
+				for i, aggregation := range aggregations {
+					if err := state.add(i, aggregation.function, fieldPaths[i], item); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*AggregateGroup, len(groups))
+	for g, state := range groups {
+		for i, aggregation := range aggregations {
+			switch {
+			case aggregation.function == aggregateAvg && state.counts[i] > 0:
+				state.group.Values[i] /= float64(state.counts[i])
+			case aggregation.function != aggregateCount && aggregation.function != aggregateSum && state.counts[i] == 0:
+				state.group.Values[i] = math.NaN()
+			}
+		}
+		result[g] = state.group
+	}
+	return result, nil
+}
+
+func newAggregateState(key []interface{}, aggregations int) *aggregateState {
+	return &aggregateState{
+		group:  &AggregateGroup{Key: key, Values: make([]float64, aggregations)},
+		counts: make([]int64, aggregations),
+	}
+}
+
+// Finds, or creates, the group of the item.
+func groupFor(item map[string]*dynamodb.AttributeValue, groupByPaths []string, aggregations int,
+	groupsByKey map[string]*aggregateState, groups *[]*aggregateState) (*aggregateState, error) {
+	if len(groupByPaths) == 0 {
+		return (*groups)[0], nil
+	}
+	keyValues := make([]*dynamodb.AttributeValue, len(groupByPaths))
+	for i, attrPath := range groupByPaths {
+		keyValues[i] = attrPathValue(item, attrPath)
+	}
+	keyJson, err := json.Marshal(keyValues)
+	if err != nil {
+		return nil, err
+	}
+	if state, ok := groupsByKey[string(keyJson)]; ok {
+		return state, nil
+	}
+	key := make([]interface{}, len(keyValues))
+	for i, av := range keyValues {
+		if av != nil {
+			if err := dynamodbattribute.Unmarshal(av, &key[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	state := newAggregateState(key, aggregations)
+	groupsByKey[string(keyJson)] = state
+	*groups = append(*groups, state)
+	return state, nil
+}
+
+func (state *aggregateState) add(i int, function, attrPath string, item map[string]*dynamodb.AttributeValue) error {
+	if function == aggregateCount {
+		state.group.Values[i]++
+		return nil
+	}
+	av := attrPathValue(item, attrPath)
+	if av == nil || av.NULL != nil {
+		return nil
+	}
+	if av.N == nil {
+		return fmt.Errorf("aggregate: %s of %s requires a number", function, attrPath)
+	}
+	n, err := strconv.ParseFloat(*av.N, 64)
+	if err != nil {
+		return err
+	}
+	values := state.group.Values
+	switch {
+	case function == aggregateSum || function == aggregateAvg:
+		values[i] += n
+	case state.counts[i] == 0:
+		values[i] = n
+	case function == aggregateMin:
+		values[i] = math.Min(values[i], n)
+	case function == aggregateMax:
+		values[i] = math.Max(values[i], n)
+	}
+	state.counts[i]++
+	return nil
+}
+
+// Finds the value at the attribute path (e.g. address.city or tags[0]) in the item, nil if there isn't one.
+func attrPathValue(item map[string]*dynamodb.AttributeValue, attrPath string) *dynamodb.AttributeValue {
+	elements, ok := parseAttrPath(attrPath)
+	if !ok {
+		return nil
+	}
+	av := &dynamodb.AttributeValue{M: item}
+	for _, element := range elements {
+		if av.M == nil {
+			return nil
+		}
+		if av = av.M[element.name]; av == nil {
+			return nil
+		}
+		for _, index := range listIndexRegex.FindAllString(element.indexes, -1) {
+			i, _ := strconv.Atoi(index)
+			if i >= len(av.L) {
+				return nil
+			}
+			av = av.L[i]
+		}
+	}
+	return av
+}
+
+// Reads every page of the query, or the scan if there is no key expression, passing the items of each page to fn.  Only
+// the given attributes are read.  If no attributes are given the items are only counted: fn is passed nil items and the
+// number of items in the page.
+func (dao *DynamoDBDao) streamItems(indexName, keyExpression, filterExpression string,
+	queryValues map[string]interface{}, attrPaths []string, ro *readOptions,
+	fn func(items []map[string]*dynamodb.AttributeValue, count int64) error) error {
+	consistentRead, err := dao.consistentReadFor(ro, indexName)
+	if err != nil {
+		return err
+	}
+	filterExpression = dao.excludeDeleted(ro, filterExpression)
+	paramValues, err := dynamodbattribute.MarshalMap(queryValues)
+	if err != nil {
+		return err
+	}
+	attrNames := make(map[string]*string)
+	keyExpression, err = dao.extractAttrNameAliasesFromExpression(keyExpression, attrNames)
+	if err != nil {
+		return err
+	}
+	filterExpression, err = dao.extractAttrNameAliasesFromExpression(filterExpression, attrNames)
+	if err != nil {
+		return err
+	}
+	// DynamoDB rejects a projection that names the same attribute twice.
+	projection := make([]string, 0, len(attrPaths))
+	projected := make(map[string]bool, len(attrPaths))
+	for _, attrPath := range attrPaths {
+		if !projected[attrPath] {
+			projected[attrPath] = true
+			projection = append(projection, aliasAttrPath(attrPath, attrNames))
+		}
+	}
+	var pageErr error
+	page := func(items []map[string]*dynamodb.AttributeValue, count *int64) bool {
+		if len(attrPaths) > 0 {
+			if len(items) > 0 {
+				pageErr = fn(items, int64(len(items)))
+			}
+		} else {
+			pageErr = fn(nil, *count)
+		}
+		return pageErr == nil
+	}
+	if keyExpression != "" {
+		query := new(dynamodb.QueryInput).
+			SetTableName(dao.TableName).
+			SetConsistentRead(consistentRead).
+			SetKeyConditionExpression(keyExpression)
+		if indexName != "" {
+			query = query.SetIndexName(indexName)
+		}
+		if filterExpression != "" {
+			query = query.SetFilterExpression(filterExpression)
+		}
+		if len(paramValues) > 0 {
+			query = query.SetExpressionAttributeValues(paramValues)
+		}
+		if len(attrNames) > 0 {
+			query = query.SetExpressionAttributeNames(attrNames)
+		}
+		if len(projection) > 0 {
+			query = query.SetProjectionExpression(strings.Join(projection, ", "))
+		} else {
+			query = query.SetSelect(dynamodb.SelectCount)
+		}
+		err = dao.queryPages(OperationQuery, query, func(result *dynamodb.QueryOutput, lastPage bool) bool {
+			return page(result.Items, result.Count)
+		})
+	} else {
+		scan := new(dynamodb.ScanInput).
+			SetTableName(dao.TableName).
+			SetConsistentRead(consistentRead)
+		if indexName != "" {
+			scan = scan.SetIndexName(indexName)
+		}
+		if filterExpression != "" {
+			scan = scan.SetFilterExpression(filterExpression)
+		}
+		if len(paramValues) > 0 {
+			scan = scan.SetExpressionAttributeValues(paramValues)
+		}
+		if len(attrNames) > 0 {
+			scan = scan.SetExpressionAttributeNames(attrNames)
+		}
+		if len(projection) > 0 {
+			scan = scan.SetProjectionExpression(strings.Join(projection, ", "))
+		} else {
+			scan = scan.SetSelect(dynamodb.SelectCount)
+		}
+		err = dao.scanPages(OperationScan, scan, func(result *dynamodb.ScanOutput, lastPage bool) bool {
+			return page(result.Items, result.Count)
+		})
+	}
+	if err == nil {
+		err = pageErr
+	}
+	return err
+}
@@ -0,0 +1,138 @@
+package dynamoDao
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type Order struct {
+	OrgId  string   `dynamodbav:"organization_id" dynamoKey:"hash"`
+	Id     string   `dynamodbav:"order_id" dynamoKey:"range"`
+	Status string   `dynamodbav:"status"`
+	Amount *float64 `dynamodbav:"amount"`
+	Lines  []int    `dynamodbav:"lines"`
+}
+
+func TestAttrPathValue(t *testing.T) {
+	item, err := dynamodbattribute.MarshalMap(map[string]interface{}{
+		"a":    1,
+		"b":    map[string]interface{}{"c": "x", "d": []interface{}{1, []interface{}{2, 3}}},
+		"tags": []string{"red", "green"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "1", *attrPathValue(item, "a").N)
+	assert.Equal(t, "x", *attrPathValue(item, "b.c").S)
+	assert.Equal(t, "3", *attrPathValue(item, "b.d[1][1]").N)
+	assert.Equal(t, "green", *attrPathValue(item, "tags[1]").S)
+	assert.Nil(t, attrPathValue(item, "nope"))
+	assert.Nil(t, attrPathValue(item, "a.b"))
+	assert.Nil(t, attrPathValue(item, "tags[2]"))
+}
+
+func TestAggregateState(t *testing.T) {
+	amount := func(status string, amount interface{}) map[string]*dynamodb.AttributeValue {
+		item, err := dynamodbattribute.MarshalMap(map[string]interface{}{"status": status, "amount": amount})
+		require.NoError(t, err)
+		return item
+	}
+	items := []map[string]*dynamodb.AttributeValue{
+		amount("open", 10), amount("closed", 5), amount("open", 2.5), amount("open", nil),
+	}
+	aggregations := []Aggregation{Count(), Sum("amount"), Min("amount"), Max("amount"), Avg("amount")}
+
+	groups := make([]*aggregateState, 0)
+	groupsByKey := make(map[string]*aggregateState)
+	for _, item := range items {
+		state, err := groupFor(item, []string{"status"}, len(aggregations), groupsByKey, &groups)
+		require.NoError(t, err)
+		for i, aggregation := range aggregations {
+			require.NoError(t, state.add(i, aggregation.function, "amount", item))
+		}
+	}
+	require.Equal(t, 2, len(groups))
+	assert.Equal(t, []interface{}{"open"}, groups[0].group.Key)
+	assert.Equal(t, []float64{3, 12.5, 2.5, 10, 12.5}, groups[0].group.Values)
+	assert.Equal(t, []int64{0, 2, 2, 2, 2}, groups[0].counts)
+	assert.Equal(t, []interface{}{"closed"}, groups[1].group.Key)
+
+	state := newAggregateState(nil, 1)
+	err := state.add(0, aggregateSum, "status", items[0])
+	assert.EqualError(t, err, "aggregate: sum of status requires a number")
+}
+
+func TestAggregateErrors(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	_, err := dao.AggregateScan("", "", nil, nil, nil)
+	assert.EqualError(t, err, "aggregate: at least one aggregation is required")
+	_, err = dao.AggregateScan("", "", nil, []string{"Nope"}, []Aggregation{Count()})
+	assert.EqualError(t, err, "aggregate: unknown field or attribute: Nope")
+	_, err = dao.AggregateScan("", "", nil, nil, []Aggregation{Sum("Nope")})
+	assert.EqualError(t, err, "aggregate: unknown field or attribute: Nope")
+	_, err = dao.AggregateQuery("", "", "", nil, nil, []Aggregation{Count()})
+	assert.EqualError(t, err, "aggregate: a key expression is required to query")
+}
+
+func TestDynamoDBDao_Aggregate(t *testing.T) {
+	sess := session.New(awsConfig)
+	client := dynamodb.New(sess)
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("Order")})
+	if err == nil {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("Order")})
+		require.NoError(t, err)
+	}
+	dao, err := NewDynamoDBDaoForType(sess, reflect.TypeOf(Order{}))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		amount := float64(i)
+		status := "open"
+		if i%3 == 0 {
+			status = "closed"
+		}
+		_, err := dao.PutItem(&Order{OrgId: "org", Id: fmt.Sprintf("%02d", i), Status: status, Amount: &amount,
+			Lines: []int{i, i * 10}})
+		require.NoError(t, err)
+	}
+	_, err = dao.PutItem(&Order{OrgId: "other", Id: "1", Status: "open"})
+	require.NoError(t, err)
+
+	groups, err := dao.Query().Key("OrgId").Eq("org").Aggregate(Count())
+	require.NoError(t, err)
+	require.Equal(t, 1, len(groups))
+	assert.Equal(t, []float64{10}, groups[0].Values)
+
+	groups, err = dao.Query().Key("OrgId").Eq("org").Range("Id").Ge("05").
+		Aggregate(Sum("Amount"), Min("Amount"), Max("Lines[1]"), Avg("Amount"))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{35, 5, 90, 7}, groups[0].Values)
+
+	groups, err = dao.Query().Key("OrgId").Eq("org").GroupBy("Status").Aggregate(Count(), Sum("Amount"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(groups))
+	assert.Equal(t, []interface{}{"closed"}, groups[0].Key)
+	assert.Equal(t, []float64{4, 18}, groups[0].Values)
+	assert.Equal(t, []interface{}{"open"}, groups[1].Key)
+	assert.Equal(t, []float64{6, 27}, groups[1].Values)
+
+	groups, err = dao.AggregateScan("", "{status} = :s", map[string]interface{}{":s": "open"}, []string{"OrgId"},
+		[]Aggregation{Count(), Max("Amount")})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(groups))
+	for _, group := range groups {
+		if group.Key[0] == "other" {
+			assert.Equal(t, float64(1), group.Values[0])
+			assert.True(t, math.IsNaN(group.Values[1]))
+		} else {
+			assert.Equal(t, []float64{6, 8}, group.Values)
+		}
+	}
+}
@@ -116,3 +116,36 @@ func parseAttrDef(field reflect.StructField, baseName string, allKeyAttrNames ma
 	}
 	return name, awsType
 }
+
+// Maps the path of every field in the struct, using the Go field names (e.g. Address.City), to the path of the
+// attribute it is stored in, using the aliases from the 'dynamodbav' tag (e.g. address.city).  Structs are descended
+// into; maps, slices, and scalar types (including time.Time and uuid.UUID) are not.
+func attributeNamesForType(structType reflect.Type) map[string]string {
+	names := make(map[string]string)
+	attributeNamesForTypeWithBaseName("", "", structType, names)
+	return names
+}
+
+func attributeNamesForTypeWithBaseName(fieldBaseName, attrBaseName string, structType reflect.Type,
+	names map[string]string) {
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		if field.PkgPath != "" {
+			continue
+		}
+		attrName := getFieldName(attrBaseName, field)
+		if attrName == "-" {
+			continue
+		}
+		fieldName := fieldBaseName + field.Name
+		names[fieldName] = attrName
+		if mapToScalarType(field.Type) == "" && (field.Type.Kind() == reflect.Struct ||
+			(field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct)) {
+			structType := field.Type
+			if structType.Kind() == reflect.Ptr {
+				structType = field.Type.Elem()
+			}
+			attributeNamesForTypeWithBaseName(fieldName+".", attrName+".", structType, names)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package dynamoDao
+
+import (
+	"container/list"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ItemCache stores items read by GetItem, by the table and key of the item (see SetItemCache), so DAOs of different
+// tables can share one.  Items are stored as their attributes so every read unmarshals a new copy.  Implementations
+// must be safe for concurrent use.
+type ItemCache interface {
+	// Returns the item with the key and whether it was found.
+	Get(key string) (map[string]*dynamodb.AttributeValue, bool)
+	Set(key string, item map[string]*dynamodb.AttributeValue)
+	Delete(key string)
+}
+
+// CacheStats counts the GetItem calls answered from the DAO's item cache and those that read the table.
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// The fraction of the reads answered from the cache, zero if there have been none.
+func (stats CacheStats) HitRatio() float64 {
+	if stats.Hits+stats.Misses == 0 {
+		return 0
+	}
+	return float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+}
+
+type itemCacheStats struct {
+	hits   int64
+	misses int64
+}
+
+// Sets the cache GetItem reads through, nil (the default) disables caching.  Items read from the table are cached
+// unless projected, and projections of cached items are read from the cache.  PutItem and UpdateItem refresh the cached
+// item and DeleteItem removes it, but changes made by other processes are only seen once a cached item expires.  A
+// strongly consistent read, whether requested with ConsistentRead or by default (see SetConsistentRead), always reads
+// the table and refreshes the cache.  Setting the cache resets its statistics.
+func (dao *DynamoDBDao) SetItemCache(cache ItemCache) *DynamoDBDao {
+	dao.itemCache = cache
+	dao.itemCacheStats = new(itemCacheStats)
+	return dao
+}
+
+// Returns the number of hits and misses of the item cache since it was set.
+func (dao *DynamoDBDao) CacheStats() CacheStats {
+	if dao.itemCacheStats == nil {
+		return CacheStats{}
+	}
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&dao.itemCacheStats.hits),
+		Misses: atomic.LoadInt64(&dao.itemCacheStats.misses),
+	}
+}
+
+// Returns the key of the item in the cache for the attributes of its key: the table name followed by the key.
+func (dao *DynamoDBDao) itemCacheKey(keyAttrs map[string]*dynamodb.AttributeValue) (string, error) {
+	// Maps are encoded with sorted keys, so the same key always encodes the same way.
+	key, err := json.Marshal(keyAttrs)
+	if err != nil {
+		return "", err
+	}
+	return dao.TableName + string(key), nil
+}
+
+func (dao *DynamoDBDao) cachedItem(keyAttrs map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+	key, err := dao.itemCacheKey(keyAttrs)
+	if err != nil {
+		return nil
+	}
+	if item, ok := dao.itemCache.Get(key); ok {
+		atomic.AddInt64(&dao.itemCacheStats.hits, 1)
+		return item
+	}
+	atomic.AddInt64(&dao.itemCacheStats.misses, 1)
+	return nil
+}
+
+// Stores the item in the cache, if there is one, or removes the item with the key if the item is empty.
+func (dao *DynamoDBDao) cacheItem(keyAttrs, item map[string]*dynamodb.AttributeValue) {
+	if dao.itemCache == nil {
+		return
+	}
+	key, err := dao.itemCacheKey(keyAttrs)
+	if err != nil {
+		return
+	}
+	if len(item) == 0 {
+		dao.itemCache.Delete(key)
+	} else {
+		dao.itemCache.Set(key, item)
+	}
+}
+
+// LRUItemCache is an in-process ItemCache holding up to a maximum number of items, evicting the least recently used
+// first, for up to a maximum time.
+type LRUItemCache struct {
+	sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruItemCacheEntry struct {
+	key     string
+	item    map[string]*dynamodb.AttributeValue
+	expires time.Time
+}
+
+// Creates a cache of up to size items that expire ttl after they are cached.  A ttl of zero means items only leave the
+// cache when evicted.
+func NewLRUItemCache(size int, ttl time.Duration) *LRUItemCache {
+	return &LRUItemCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (cache *LRUItemCache) Get(key string) (map[string]*dynamodb.AttributeValue, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*lruItemCacheEntry)
+	if cache.ttl > 0 && time.Now().After(entry.expires) {
+		cache.remove(element)
+		return nil, false
+	}
+	cache.order.MoveToFront(element)
+	return entry.item, true
+}
+
+func (cache *LRUItemCache) Set(key string, item map[string]*dynamodb.AttributeValue) {
+	cache.Lock()
+	defer cache.Unlock()
+	expires := time.Now().Add(cache.ttl)
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*lruItemCacheEntry)
+		entry.item, entry.expires = item, expires
+		cache.order.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.order.PushFront(&lruItemCacheEntry{key: key, item: item, expires: expires})
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *LRUItemCache) Delete(key string) {
+	cache.Lock()
+	defer cache.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+}
+
+// Returns the number of items in the cache, including any that have expired but not yet been removed.
+func (cache *LRUItemCache) Len() int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.order.Len()
+}
+
+func (cache *LRUItemCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*lruItemCacheEntry).key)
+}
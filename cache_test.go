@@ -0,0 +1,161 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type CachedStruct struct {
+	Id    string `dynamodbav:"id" dynamoKey:"hash"`
+	Value string `dynamodbav:"value"`
+}
+
+type CachedStructValue struct {
+	Value string `dynamodbav:"value"`
+}
+
+func cachedAttrs(id, value string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"id":    new(dynamodb.AttributeValue).SetS(id),
+		"value": new(dynamodb.AttributeValue).SetS(value),
+	}
+}
+
+func TestLRUItemCache(t *testing.T) {
+	cache := NewLRUItemCache(2, 0)
+	cache.Set("a", cachedAttrs("a", "1"))
+	cache.Set("b", cachedAttrs("b", "1"))
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	// b is the least recently used.
+	cache.Set("c", cachedAttrs("c", "1"))
+	assert.Equal(t, 2, cache.Len())
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+
+	cache.Set("a", cachedAttrs("a", "2"))
+	item, ok := cache.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "2", *item["value"].S)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Delete("a")
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+
+	cache = NewLRUItemCache(10, 50*time.Millisecond)
+	cache.Set("a", cachedAttrs("a", "1"))
+	_, ok = cache.Get("a")
+	assert.True(t, ok)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestGetItemFromCache(t *testing.T) {
+	dao := newTestDao(t, "CachedStruct", reflect.TypeOf(CachedStruct{}))
+	assert.Equal(t, CacheStats{}, dao.CacheStats())
+
+	cache := NewLRUItemCache(10, time.Minute)
+	dao.SetItemCache(cache)
+	keyAttrs, err := dao.MarshalKey(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	dao.cacheItem(keyAttrs, cachedAttrs("1", "cached"))
+
+	item, err := dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStruct{Id: "1", Value: "cached"}, item)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"}, ProjectInto(CachedStructValue{}))
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStructValue{Value: "cached"}, item)
+
+	stats := dao.CacheStats()
+	assert.Equal(t, CacheStats{Hits: 2}, stats)
+	assert.Equal(t, 1.0, stats.HitRatio())
+	assert.Equal(t, 0.5, CacheStats{Hits: 1, Misses: 1}.HitRatio())
+
+	// A DAO that reads consistently by default reads the table, and refreshes the cache with what it read.
+	dao.SetLogger(nil).AddInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+		return new(dynamodb.GetItemOutput).SetItem(cachedAttrs("1", "table")), nil
+	})
+	dao.SetConsistentRead(true)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStruct{Id: "1", Value: "table"}, item)
+	dao.SetConsistentRead(false)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStruct{Id: "1", Value: "table"}, item)
+	assert.Equal(t, CacheStats{Hits: 3}, dao.CacheStats())
+
+	dao.cacheItem(keyAttrs, nil)
+	assert.Equal(t, 0, cache.Len())
+}
+
+func TestItemCacheSharedByTables(t *testing.T) {
+	cache := NewLRUItemCache(10, time.Minute)
+	daoA := newTestDao(t, "CachedStructA", reflect.TypeOf(CachedStruct{})).SetItemCache(cache)
+	daoB := newTestDao(t, "CachedStructB", reflect.TypeOf(CachedStruct{})).SetItemCache(cache)
+	keyAttrs, err := daoA.MarshalKey(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	daoA.cacheItem(keyAttrs, cachedAttrs("1", "a"))
+
+	recorder := new(requestRecorder)
+	recorder.item = cachedAttrs("1", "b")
+	daoB.SetLogger(nil).AddInterceptors(recorder.intercept)
+	item, err := daoB.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStruct{Id: "1", Value: "b"}, item)
+	assert.Equal(t, 1, len(recorder.inputs))
+	assert.Equal(t, 2, cache.Len())
+
+	item, err = daoA.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &CachedStruct{Id: "1", Value: "a"}, item)
+}
+
+func TestDynamoDBDao_ItemCache(t *testing.T) {
+	sess := session.New(awsConfig)
+	client := dynamodb.New(sess)
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("CachedStruct")})
+	if err == nil {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("CachedStruct")})
+		require.NoError(t, err)
+	}
+	dao, err := NewDynamoDBDaoForType(sess, reflect.TypeOf(CachedStruct{}))
+	require.NoError(t, err)
+	dao.SetItemCache(NewLRUItemCache(10, time.Minute))
+
+	item, err := dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Nil(t, item)
+
+	_, err = dao.PutItem(&CachedStruct{Id: "1", Value: "put"})
+	require.NoError(t, err)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "put", item.(*CachedStruct).Value)
+
+	_, err = dao.UpdateItem(&CachedStruct{Id: "1", Value: "updated"})
+	require.NoError(t, err)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "updated", item.(*CachedStruct).Value)
+
+	_, err = dao.DeleteItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	item, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Nil(t, item)
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2}, dao.CacheStats())
+}
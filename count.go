@@ -0,0 +1,161 @@
+package dynamoDao
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TotalMode determines how SearchPage.TotalSize is computed by PagedQuery and PagedScan.
+type TotalMode int
+
+const (
+	// TotalExact runs a COUNT query or scan with the same conditions as the page being read.  This is the default and
+	// roughly doubles the cost of reading a page unless the DAO caches counts (see SetCountCacheTTL).
+	TotalExact TotalMode = iota
+	// TotalNone does not compute the total, TotalSize is set to -1.
+	TotalNone
+	// TotalApproximate uses the ItemCount of the table or index from DescribeTable.  DynamoDB only updates this about
+	// every six hours and it ignores the conditions of the query.  A DAO scoped to a tenant (see ForTenant) counts
+	// exactly instead.
+	TotalApproximate
+)
+
+const (
+	// The number of cached counts above which expired entries are swept out when a new count is cached.
+	countCacheSweepSize = 1024
+)
+
+// TotalSizeMode overrides the DAO's default TotalMode (see SetTotalSizeMode) for a single PagedQuery or PagedScan.
+func TotalSizeMode(mode TotalMode) ReadOption {
+	return func(ro *readOptions) {
+		ro.totalMode = &mode
+	}
+}
+
+// Sets the TotalMode used by PagedQuery and PagedScan when not overridden by the TotalSizeMode option.
+func (dao *DynamoDBDao) SetTotalSizeMode(mode TotalMode) *DynamoDBDao {
+	dao.totalMode = mode
+	return dao
+}
+
+// Sets how long the exact and approximate totals are cached for.  Counts are cached per query signature: the index,
+// expressions, and values of the query.  A ttl of zero, the default, disables caching.
+func (dao *DynamoDBDao) SetCountCacheTTL(ttl time.Duration) *DynamoDBDao {
+	dao.counts.Lock()
+	defer dao.counts.Unlock()
+	dao.counts.ttl = ttl
+	dao.counts.entries = nil
+	return dao
+}
+
+type countCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	entries map[string]countCacheEntry
+}
+
+type countCacheEntry struct {
+	count   int64
+	expires time.Time
+}
+
+func (cc *countCache) get(signature string) (int64, bool) {
+	cc.Lock()
+	defer cc.Unlock()
+	entry, ok := cc.entries[signature]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(cc.entries, signature)
+		return 0, false
+	}
+	return entry.count, true
+}
+
+func (cc *countCache) put(signature string, count int64) {
+	cc.Lock()
+	defer cc.Unlock()
+	if cc.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	if cc.entries == nil {
+		cc.entries = make(map[string]countCacheEntry)
+	} else if len(cc.entries) >= countCacheSweepSize {
+		for sig, entry := range cc.entries {
+			if now.After(entry.expires) {
+				delete(cc.entries, sig)
+			}
+		}
+	}
+	cc.entries[signature] = countCacheEntry{count: count, expires: now.Add(cc.ttl)}
+}
+
+// Builds the key counts are cached under from everything that affects the result of a count.
+func countSignature(parts []string, values map[string]*dynamodb.AttributeValue) (string, error) {
+	valuesJson, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(append(parts, string(valuesJson)), "\x00"), nil
+}
+
+func (dao *DynamoDBDao) totalModeFor(ro *readOptions) TotalMode {
+	if ro.totalMode != nil {
+		return *ro.totalMode
+	}
+	return dao.totalMode
+}
+
+// Computes the total for a page according to the TotalMode.  The exact count is computed by the count function.
+func (dao *DynamoDBDao) totalSize(mode TotalMode, indexName, signature string, count func() (int64, error)) (int64, error) {
+	if mode == TotalApproximate && dao.tenant != nil {
+		// The item count of the table covers every tenant.
+		mode = TotalExact
+	}
+	switch mode {
+	case TotalNone:
+		return -1, nil
+	case TotalApproximate:
+		signature = "approximate\x00" + indexName
+		count = func() (int64, error) {
+			return dao.approximateItemCount(indexName)
+		}
+	}
+	if total, ok := dao.counts.get(signature); ok {
+		return total, nil
+	}
+	total, err := count()
+	if err != nil {
+		return 0, err
+	}
+	dao.counts.put(signature, total)
+	return total, nil
+}
+
+func (dao *DynamoDBDao) approximateItemCount(indexName string) (int64, error) {
+	describeTableResponse, err := dao.describeTable(new(dynamodb.DescribeTableInput).SetTableName(dao.TableName))
+	if err != nil {
+		return 0, err
+	}
+	table := describeTableResponse.Table
+	if indexName == "" {
+		return aws.Int64Value(table.ItemCount), nil
+	}
+	for _, gsi := range table.GlobalSecondaryIndexes {
+		if *gsi.IndexName == indexName {
+			return aws.Int64Value(gsi.ItemCount), nil
+		}
+	}
+	for _, lsi := range table.LocalSecondaryIndexes {
+		if *lsi.IndexName == indexName {
+			return aws.Int64Value(lsi.ItemCount), nil
+		}
+	}
+	return aws.Int64Value(table.ItemCount), nil
+}
@@ -0,0 +1,73 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCountCache(t *testing.T) {
+	cc := new(countCache)
+	cc.put("a", 5)
+	_, ok := cc.get("a")
+	assert.False(t, ok, "counts must not be cached without a ttl")
+
+	cc.ttl = 50 * time.Millisecond
+	cc.put("a", 5)
+	count, ok := cc.get("a")
+	require.True(t, ok)
+	assert.EqualValues(t, 5, count)
+	_, ok = cc.get("b")
+	assert.False(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cc.get("a")
+	assert.False(t, ok)
+	assert.Empty(t, cc.entries)
+}
+
+func TestTotalSize(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+	calls := 0
+	count := func() (int64, error) {
+		calls++
+		return 42, nil
+	}
+
+	total, err := dao.totalSize(TotalNone, "", "sig", count)
+	require.NoError(t, err)
+	assert.EqualValues(t, -1, total)
+	assert.Equal(t, 0, calls)
+
+	total, err = dao.totalSize(TotalExact, "", "sig", count)
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, total)
+	total, err = dao.totalSize(TotalExact, "", "sig", count)
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, total)
+	assert.Equal(t, 2, calls)
+
+	dao.SetCountCacheTTL(time.Minute)
+	for i := 0; i < 3; i++ {
+		total, err = dao.totalSize(TotalExact, "", "sig", count)
+		require.NoError(t, err)
+		assert.EqualValues(t, 42, total)
+	}
+	assert.Equal(t, 3, calls)
+
+	_, err = dao.totalSize(TotalExact, "", "other", func() (int64, error) {
+		return 0, errors.New("boom")
+	})
+	assert.Error(t, err)
+}
+
+func TestTotalModeFor(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+	assert.Equal(t, TotalExact, dao.totalModeFor(newReadOptions(nil)))
+	dao.SetTotalSizeMode(TotalNone)
+	assert.Equal(t, TotalNone, dao.totalModeFor(newReadOptions(nil)))
+	assert.Equal(t, TotalApproximate, dao.totalModeFor(newReadOptions([]ReadOption{TotalSizeMode(TotalApproximate)})))
+}
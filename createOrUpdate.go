@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"log"
 	"reflect"
 	"strconv"
 	"time"
@@ -135,11 +135,21 @@ func (dao *DynamoDBDao) extractTableDescription() error {
 	if err != nil {
 		return err
 	}
+	keyTemplates, err := keyTemplatesForType(dao.structType)
+	if err != nil {
+		return err
+	}
 	allKeyAttrNames := collectUniqueKeyNames(keySchema, globalIndexes, localIndexes)
 	attributes, attrToField, err := attributeDefinitionsForType(dao.structType, allKeyAttrNames)
 	if err != nil {
 		return err
 	}
+	for _, kt := range keyTemplates {
+		attributes = append(attributes, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(kt.attrName),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		})
+	}
 	dao.tableDescription = &dynamodb.CreateTableInput{
 		AttributeDefinitions:   attributes,
 		KeySchema:              keySchema,
@@ -155,6 +165,7 @@ func (dao *DynamoDBDao) extractTableDescription() error {
 		}
 	}
 	dao.attrToField = attrToField
+	dao.keyTemplates = keyTemplates
 	return nil
 }
 
@@ -180,17 +191,16 @@ func (dao *DynamoDBDao) createOrUpdateTable(createTableInput *dynamodb.CreateTab
 	go func() {
 		exists := true
 		describeTableRequest := new(dynamodb.DescribeTableInput).SetTableName(*createTableInput.TableName)
-		describeTableResponse, err := dao.Client.DescribeTable(describeTableRequest)
+		describeTableResponse, err := dao.describeTable(describeTableRequest)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) {
 				if awsErr.Code() != "ResourceNotFoundException" {
-					log.Printf("error from Describe Table call: %s", err.Error())
 					promise <- err
 					return
 				}
 				exists = false
 			} else {
-				log.Printf("non-aws error from describe table call: %s", err.Error())
 				promise <- err
 				return
 			}
@@ -212,11 +222,29 @@ func (dao *DynamoDBDao) createOrUpdateTable(createTableInput *dynamodb.CreateTab
 	return promise
 }
 
+func (dao *DynamoDBDao) describeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	output, err := dao.send(OperationDescribeTable, "", input, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.DescribeTableWithContext(aws.BackgroundContext(), input, reqOpts...)
+	})
+	describeTableOutput, _ := output.(*dynamodb.DescribeTableOutput)
+	return describeTableOutput, err
+}
+
+func (dao *DynamoDBDao) updateTableSchema(input *dynamodb.UpdateTableInput) (*dynamodb.UpdateTableOutput, error) {
+	output, err := dao.send(OperationUpdateTable, "", input, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.UpdateTableWithContext(aws.BackgroundContext(), input, reqOpts...)
+	})
+	updateTableOutput, _ := output.(*dynamodb.UpdateTableOutput)
+	return updateTableOutput, err
+}
+
 func (dao *DynamoDBDao) createTable(createTableInput *dynamodb.CreateTableInput, promise chan error) error {
-	_, err := dao.Client.CreateTable(createTableInput)
+	_, err := dao.send(OperationCreateTable, "", createTableInput,
+		func(reqOpts ...request.Option) (interface{}, error) {
+			return dao.Client.CreateTableWithContext(aws.BackgroundContext(), createTableInput, reqOpts...)
+		})
 	if err != nil {
-		promise <- errors.New(fmt.Sprintf("error occurred while creating table: %+v: %s",
-			createTableInput.GoString(), err.Error()))
+		promise <- fmt.Errorf("error occurred while creating table: %+v: %w", createTableInput.GoString(), err)
 		return err
 	}
 	return dao.awaitTableStatusActive(*createTableInput.TableName, promise)
@@ -224,6 +252,13 @@ func (dao *DynamoDBDao) createTable(createTableInput *dynamodb.CreateTableInput,
 
 func (dao *DynamoDBDao) updateTable(newSchema *dynamodb.CreateTableInput, currentSchema *dynamodb.DescribeTableOutput,
 	promise chan error) error {
+	if !reflect.DeepEqual(newSchema.KeySchema, currentSchema.Table.KeySchema) {
+		err := &DaoError{Table: *newSchema.TableName, Operation: OperationUpdateTable, Kind: ErrSchemaMismatch,
+			Err: fmt.Errorf("the key schema %s cannot be changed to %s", currentSchema.Table.KeySchema,
+				newSchema.KeySchema)}
+		promise <- err
+		return err
+	}
 	err := dao.updateProvisionedThroughputIfNeeded(newSchema, currentSchema, promise)
 	if err != nil {
 		return err
@@ -242,9 +277,9 @@ func (dao *DynamoDBDao) updateProvisionedThroughputIfNeeded(newSchema *dynamodb.
 			SetAttributeDefinitions(newSchema.AttributeDefinitions).
 			SetTableName(*newSchema.TableName)
 		updateTableInput = updateTableInput.SetProvisionedThroughput(newSchema.ProvisionedThroughput)
-		_, err := dao.Client.UpdateTable(updateTableInput)
+		_, err := dao.updateTableSchema(updateTableInput)
 		if err != nil {
-			err = errors.New(fmt.Sprintf("error occurred while updating table: %+v: %s", newSchema, err.Error()))
+			err = fmt.Errorf("error occurred while updating table: %+v: %w", newSchema, err)
 			promise <- err
 			return err
 		}
@@ -268,9 +303,9 @@ func (dao *DynamoDBDao) updateStreamingSpecIfNeeded(newSchema *dynamodb.CreateTa
 			streamSpec = &dynamodb.StreamSpecification{StreamEnabled: aws.Bool(false)}
 		}
 		updateTableInput = updateTableInput.SetStreamSpecification(streamSpec)
-		_, err := dao.Client.UpdateTable(updateTableInput)
+		_, err := dao.updateTableSchema(updateTableInput)
 		if err != nil {
-			promise <- errors.New(fmt.Sprintf("error occurred while updating table: %+v: %s", newSchema, err.Error()))
+			promise <- fmt.Errorf("error occurred while updating table: %+v: %w", newSchema, err)
 			return err
 		}
 		err = dao.awaitTableStatusActive(*newSchema.TableName, promise)
@@ -289,9 +324,9 @@ func (dao *DynamoDBDao) updateGlobalSecondaryIndexesIfNeeded(newSchema *dynamodb
 		SetTableName(*newSchema.TableName)
 	for _, action := range actions {
 		updateTableInput = updateTableInput.SetGlobalSecondaryIndexUpdates([]*dynamodb.GlobalSecondaryIndexUpdate{action})
-		_, err := dao.Client.UpdateTable(updateTableInput)
+		_, err := dao.updateTableSchema(updateTableInput)
 		if err != nil {
-			promise <- errors.New(fmt.Sprintf("error occurred while updating table: %+v: %s", actions, err.Error()))
+			promise <- fmt.Errorf("error occurred while updating table: %+v: %w", actions, err)
 			return err
 		}
 		var indexName string
@@ -376,16 +411,17 @@ func (dao *DynamoDBDao) awaitTableStatusActive(tableName string, promise chan er
 		select {
 		case <-tick:
 		case <-timeout:
-			err := errors.New(fmt.Sprintf("timeout while waiting for created table to become active: %s", tableName))
+			err := &DaoError{Table: tableName, Operation: OperationDescribeTable, Kind: ErrTableNotActive,
+				Err: fmt.Errorf("timeout while waiting for created table to become active: %s", tableName)}
 			promise <- err
 			return err
 		}
 		describeTableRequest := new(dynamodb.DescribeTableInput).SetTableName(tableName)
-		describeTableResponse, err := dao.Client.DescribeTable(describeTableRequest)
+		describeTableResponse, err := dao.describeTable(describeTableRequest)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) {
 				if awsErr.Code() != "ResourceNotFoundException" {
-					log.Printf("error from Describe Table call for verification: %s", err.Error())
 					promise <- err
 					return err
 				}
@@ -407,16 +443,17 @@ func (dao *DynamoDBDao) awaitTableIndexStatusActive(tableName string, indexName
 		select {
 		case <-tick:
 		case <-timeout:
-			err := errors.New(fmt.Sprintf("timeout while waiting for created table to become active: %s", tableName))
+			err := &DaoError{Table: tableName, Operation: OperationDescribeTable, Kind: ErrTableNotActive,
+				Err: fmt.Errorf("timeout while waiting for created table to become active: %s", tableName)}
 			promise <- err
 			return err
 		}
 		describeTableRequest := new(dynamodb.DescribeTableInput).SetTableName(tableName)
-		describeTableResponse, err := dao.Client.DescribeTable(describeTableRequest)
+		describeTableResponse, err := dao.describeTable(describeTableRequest)
 		if err != nil {
-			if awsErr, ok := err.(awserr.Error); ok {
+			var awsErr awserr.Error
+			if errors.As(err, &awsErr) {
 				if awsErr.Code() != "ResourceNotFoundException" {
-					log.Printf("error from Describe Table call for verification: %s", err.Error())
 					promise <- err
 					return err
 				}
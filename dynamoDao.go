@@ -1,11 +1,12 @@
 package dynamoDao
 
 import (
-	"github.com/aws/aws-sdk-go/aws/awserr"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"log"
 	"reflect"
 	"time"
 )
@@ -27,9 +28,29 @@ type DynamoDBDao struct {
 	writeCapacity    int64
 	enableStreaming  bool
 	streamViewType   string
+	consistentRead   bool
+	descending       bool
+	totalMode        TotalMode
+	counts           countCache
+	tokenKey         []byte
+	encryptTokens    bool
 	keyAttrNames     []string
+	keyTemplates     []*keyTemplate
+	typeAttribute    string
+	types            map[string]*registeredType
+	tenant           *tenantScope
+	deletedAt        *deletedAtField
 	attrToField      map[string]*reflect.StructField
 	tableDescription *dynamodb.CreateTableInput
+	itemCache        ItemCache
+	itemCacheStats   *itemCacheStats
+	metrics          MetricsCollector
+	logger           Logger
+	logRequests      int32
+	logUnredacted    bool
+	interceptors     []Interceptor
+	retryPolicy      *RetryPolicy
+	notFoundError    bool
 }
 
 func NewDynamoDBDao(sess *session.Session,
@@ -46,19 +67,43 @@ func NewDynamoDBDao(sess *session.Session,
 		enableStreaming: enableStreaming,
 		streamViewType:  streamViewType,
 		structType:      structType,
+		tokenKey:        newTokenKey(),
+		logger:          NewStdLogger(nil, LogInfo),
 	}
 	err := dao.extractTableDescription()
 	if err != nil {
 		return nil, err
 	}
+	if structType.Kind() == reflect.Struct {
+		if _, err := rulesFor(structType); err != nil {
+			return nil, err
+		}
+		if dao.deletedAt, err = deletedAtFieldFor(structType); err != nil {
+			return nil, err
+		}
+		if typeTagged(structType) {
+			if err := dao.RegisterType(structType, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
 	return dao, nil
 }
 
-func NewDynamoDBDaoForType(sess *session.Session, typ reflect.Type) (*DynamoDBDao, error) {
+// DaoOption configures a DAO created by NewDynamoDBDaoForType before its table is created or updated, e.g.
+// WithInterceptors.
+type DaoOption func(dao *DynamoDBDao)
+
+// Creates a DAO for the struct type with a table named after it, and creates the table or updates it to match the
+// type.  The options are applied first, so that they apply to the requests creating or updating the table as well.
+func NewDynamoDBDaoForType(sess *session.Session, typ reflect.Type, opts ...DaoOption) (*DynamoDBDao, error) {
 	dao, err := NewDynamoDBDao(sess, typ.Name(), 0, 0, false, "", typ)
 	if err != nil {
 		return nil, err
 	}
+	for _, opt := range opts {
+		opt(dao)
+	}
 	promise := dao.CreateOrUpdateTableForType(typ)
 	err = <-promise
 	if err != nil {
@@ -75,8 +120,85 @@ func getStructType(t interface{}) reflect.Type {
 	return structType
 }
 
+// Sets whether reads are strongly consistent when not overridden by the ConsistentRead option.  The default is
+// eventually consistent reads.  Reads on global secondary indexes are always eventually consistent.
+func (dao *DynamoDBDao) SetConsistentRead(consistent bool) *DynamoDBDao {
+	dao.consistentRead = consistent
+	return dao
+}
+
+// Sets the order queries return their results in when not overridden by the ScanIndexForward option.  The default is
+// ascending order of the range key.
+func (dao *DynamoDBDao) SetScanIndexForward(forward bool) *DynamoDBDao {
+	dao.descending = !forward
+	return dao
+}
+
+func (dao *DynamoDBDao) findGlobalIndex(indexName string) *dynamodb.GlobalSecondaryIndex {
+	for _, gsi := range dao.tableDescription.GlobalSecondaryIndexes {
+		if *gsi.IndexName == indexName {
+			return gsi
+		}
+	}
+	return nil
+}
+
+func (dao *DynamoDBDao) findLocalIndex(indexName string) *dynamodb.LocalSecondaryIndex {
+	for _, lsi := range dao.tableDescription.LocalSecondaryIndexes {
+		if *lsi.IndexName == indexName {
+			return lsi
+		}
+	}
+	return nil
+}
+
+// Returns the key schema of the given index, or of the table if the index name is empty.
+func (dao *DynamoDBDao) indexKeySchema(indexName string) ([]*dynamodb.KeySchemaElement, error) {
+	if indexName == "" {
+		return dao.tableDescription.KeySchema, nil
+	}
+	if gsi := dao.findGlobalIndex(indexName); gsi != nil {
+		return gsi.KeySchema, nil
+	}
+	if lsi := dao.findLocalIndex(indexName); lsi != nil {
+		return lsi.KeySchema, nil
+	}
+	return nil, errors.New("unknown index: " + indexName)
+}
+
+// Returns the attributes needed for the ExclusiveStartKey of a query or scan on the given index: the key attributes
+// of the table followed by those of the index.
+func (dao *DynamoDBDao) indexKeyAttrNames(indexName string) []string {
+	keyAttrs := append([]string(nil), dao.keyAttrNames...)
+	// An unknown index is reported by DynamoDB.
+	indexKeySchema, _ := dao.indexKeySchema(indexName)
+	for _, ks := range indexKeySchema {
+		found := false
+		for _, name := range keyAttrs {
+			if name == *ks.AttributeName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			keyAttrs = append(keyAttrs, *ks.AttributeName)
+		}
+	}
+	return keyAttrs
+}
+
+// Writes the item, replacing any item with the same key.  The BeforeSaver and AfterSaver hooks of the item are called
+// before and after it is written; for an item passed by value they are called on a copy, which is returned.  The item
+// is validated (see Validate) after BeforeSave, and is not written if it is invalid.
 func (dao *DynamoDBDao) PutItem(t interface{}) (interface{}, error) {
-	attrVals, err := dao.MarshalAttributes(t)
+	item := hookTarget(t)
+	if err := beforeSave(item); err != nil {
+		return nil, err
+	}
+	if err := Validate(item); err != nil {
+		return nil, dao.wrapError(OperationPutItem, "", err)
+	}
+	attrVals, err := dao.MarshalAttributes(item)
 	if err != nil {
 		return nil, err
 	}
@@ -84,38 +206,71 @@ func (dao *DynamoDBDao) PutItem(t interface{}) (interface{}, error) {
 	putItem := new(dynamodb.PutItemInput).SetItem(attrVals).SetTableName(dao.TableName).
 		SetReturnValues(dynamodb.ReturnValueNone)
 
-	_, err = dao.Client.PutItem(putItem)
+	_, err = dao.send(OperationPutItem, "", putItem, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.PutItemWithContext(aws.BackgroundContext(), putItem, reqOpts...)
+	})
 	if err != nil {
-		if awserr, ok := err.(awserr.Error); ok {
-			log.Printf("ERROR: %+v: %+v", awserr, putItem)
-			return nil, awserr
-		}
 		return nil, err
 	}
+	if dao.itemCache != nil {
+		keyAttrs, err := dao.MarshalKey(item)
+		if err != nil {
+			return nil, err
+		}
+		dao.cacheItem(keyAttrs, attrVals)
+	}
 
-	return t, nil
+	if err := afterSave(item); err != nil {
+		return nil, err
+	}
+	return hookResult(t, item), nil
 }
 
 func (dao *DynamoDBDao) MarshalAttributes(t interface{}) (map[string]*dynamodb.AttributeValue, error) {
+	t, err := dao.withTenant(t)
+	if err != nil {
+		return nil, err
+	}
 	attrVals, err := dynamodbattribute.MarshalMap(t)
 	if err != nil {
 		return nil, err
 	}
+	dao.omitDeletedAt(t, attrVals)
+	if err := dao.fillKeyTemplates(t, attrVals); err != nil {
+		return nil, err
+	}
+	dao.stampType(t, attrVals)
+	if err := dao.scopeAttributes(attrVals); err != nil {
+		return nil, err
+	}
 	return attrVals, nil
 }
 
 func (dao *DynamoDBDao) UnmarshalAttributes(attributes map[string]*dynamodb.AttributeValue) (interface{}, error) {
-	newT := reflect.New(dao.structType).Elem().Interface()
+	attributes, err := dao.unscopeAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+	newT := reflect.New(dao.itemType(attributes)).Elem().Interface()
 	ptrT := to_struct_ptr(newT)
-	err := dynamodbattribute.UnmarshalMap(attributes, ptrT)
+	err = dynamodbattribute.UnmarshalMap(attributes, ptrT)
 	if err != nil {
 		return nil, err
 	}
+	if err := dao.parseKeyTemplates(attributes, ptrT); err != nil {
+		return nil, err
+	}
+	if err := dao.checkTenant(ptrT); err != nil {
+		return nil, err
+	}
+	if err := afterLoad(ptrT); err != nil {
+		return nil, err
+	}
 	return ptrT, nil
 }
 
 func (dao *DynamoDBDao) MarshalKey(key interface{}) (map[string]*dynamodb.AttributeValue, error) {
-	keyAttrs, err := dynamodbattribute.MarshalMap(key)
+	keyAttrs, err := dao.MarshalAttributes(key)
 	if err != nil {
 		return nil, err
 	}
@@ -129,8 +284,18 @@ func (dao *DynamoDBDao) MarshalKey(key interface{}) (map[string]*dynamodb.Attrib
 	return keyAttrs, nil
 }
 
+// Writes the non-key attributes of the item to the item with the same key, returning the item as it is now stored.
+// The BeforeSaver hook of the item is called before it is written and the AfterSaver hook of the returned item after.
+// The item is validated (see Validate) after BeforeSave, and is not written if it is invalid.
 func (dao *DynamoDBDao) UpdateItem(t interface{}) (interface{}, error) {
-	itemVals, err := dynamodbattribute.MarshalMap(t)
+	item := hookTarget(t)
+	if err := beforeSave(item); err != nil {
+		return nil, err
+	}
+	if err := Validate(item); err != nil {
+		return nil, dao.wrapError(OperationUpdateItem, "", err)
+	}
+	itemVals, err := dao.MarshalAttributes(item)
 	if err != nil {
 		return nil, err
 	}
@@ -146,69 +311,137 @@ func (dao *DynamoDBDao) UpdateItem(t interface{}) (interface{}, error) {
 	updateItem := new(dynamodb.UpdateItemInput).SetKey(keyVals).SetTableName(dao.TableName).
 		SetAttributeUpdates(itemUpdates).SetReturnValues(dynamodb.ReturnValueAllNew)
 
-	updateItemResponse, err := dao.Client.UpdateItem(updateItem)
+	output, err := dao.send(OperationUpdateItem, "", updateItem, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.UpdateItemWithContext(aws.BackgroundContext(), updateItem, reqOpts...)
+	})
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, updateItemResponse)
 		return nil, err
 	}
+	updateItemResponse := output.(*dynamodb.UpdateItemOutput)
+	dao.cacheItem(keyVals, updateItemResponse.Attributes)
 	ptrT, err := dao.UnmarshalAttributes(updateItemResponse.Attributes)
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, updateItemResponse)
+		dao.log(LogError, "unmarshal failed", LogField{Key: "op", Value: OperationUpdateItem},
+			LogField{Key: "error", Value: err})
+		return nil, err
+	}
+	if err := afterSave(ptrT); err != nil {
 		return nil, err
 	}
 	return ptrT, nil
 }
 
-func (dao *DynamoDBDao) GetItem(key interface{}) (interface{}, error) {
+// Reads the item with the given key, returning nil, or ErrNotFound if the DAO is set to (see SetNotFoundError), if
+// there isn't one.  An item that has been soft deleted (see DeleteItem) is treated as if there isn't one unless the
+// IncludeDeleted option is given.  If the DAO has an item cache (see SetItemCache) the item is read through it.
+func (dao *DynamoDBDao) GetItem(key interface{}, opts ...ReadOption) (interface{}, error) {
+	ro := newReadOptions(opts)
 
 	keyAttrs, err := dao.MarshalKey(key)
 	if err != nil {
 		return nil, err
 	}
 
-	getItem := new(dynamodb.GetItemInput).SetTableName(dao.TableName).SetKey(keyAttrs)
-
-	response, err := dao.Client.GetItem(getItem)
+	consistentRead, err := dao.consistentReadFor(ro, "")
+	if err != nil {
+		return nil, err
+	}
+	getItem := new(dynamodb.GetItemInput).SetTableName(dao.TableName).SetKey(keyAttrs).
+		SetConsistentRead(consistentRead)
+	attrNames := make(map[string]*string)
+	var alwaysProject []string
+	if dao.excludesDeleted(ro) {
+		alwaysProject = []string{dao.deletedAt.attrName}
+	}
+	projection, err := dao.projectionExpression(ro, alwaysProject, attrNames)
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, getItem)
 		return nil, err
 	}
-	if len(response.Item) == 0 {
+	// Items projected by field are read from the table, as the fields not projected must be left at their zero value.
+	// Otherwise the whole item is read so that it can be cached.
+	useCache := dao.itemCache != nil && len(ro.projectedFields) == 0
+	var item map[string]*dynamodb.AttributeValue
+	if useCache && !consistentRead {
+		item = dao.cachedItem(keyAttrs)
+	}
+	if item == nil {
+		if projection != "" && !useCache {
+			getItem = getItem.SetProjectionExpression(projection).SetExpressionAttributeNames(attrNames)
+		}
+
+		output, err := dao.send(OperationGetItem, "", getItem, func(reqOpts ...request.Option) (interface{}, error) {
+			return dao.Client.GetItemWithContext(aws.BackgroundContext(), getItem, reqOpts...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		item = output.(*dynamodb.GetItemOutput).Item
+		if useCache {
+			dao.cacheItem(keyAttrs, item)
+		}
+	}
+	if len(item) == 0 || (dao.excludesDeleted(ro) && dao.isDeleted(item)) {
+		if dao.notFoundError {
+			return nil, &DaoError{Table: dao.TableName, Operation: OperationGetItem, Kind: ErrNotFound}
+		}
 		return nil, nil
 	}
-	ptrT, err := dao.UnmarshalAttributes(response.Item)
+	ptrT, err := dao.unmarshalProjection(ro, item)
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, response)
+		dao.log(LogError, "unmarshal failed", LogField{Key: "op", Value: OperationGetItem},
+			LogField{Key: "error", Value: err})
 		return nil, err
 	}
 	return ptrT, nil
 }
 
+// Deletes the item with the given key, returning the item deleted or nil if there wasn't one.  The BeforeDeleter hook
+// of the key is called before the item is deleted.  If the DAO's type has a field tagged with dynamoDeletedAt, e.g.
+//
+//	DeletedAt *time.Time `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+//
+// the item is soft deleted instead: the field's attribute is set to the current time and reads leave the item out
+// unless they are given the IncludeDeleted option.  Soft deleted items can be brought back with Restore and removed
+// for good with Purge.  Deleting an item that is already soft deleted returns nil.  Items stored as a registered type
+// without such a field (see RegisterType) are deleted for good.
 func (dao *DynamoDBDao) DeleteItem(key interface{}) (interface{}, error) {
+	if dao.deletedAt != nil {
+		return dao.softDelete(key)
+	}
+	return dao.Purge(key)
+}
+
+// Deletes the item with the given key from the table, even if the DAO soft deletes items (see DeleteItem), returning
+// the item deleted or nil if there wasn't one.  The BeforeDeleter hook of the key is called before the item is
+// deleted.
+func (dao *DynamoDBDao) Purge(key interface{}) (interface{}, error) {
+	if err := beforeDelete(hookTarget(key)); err != nil {
+		return nil, err
+	}
 
 	keyAttrs, err := dao.MarshalKey(key)
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, key)
+		dao.log(LogError, "marshal key failed", LogField{Key: "op", Value: OperationDeleteItem},
+			LogField{Key: "error", Value: err})
 		return nil, err
 	}
 
 	deleteItem := new(dynamodb.DeleteItemInput).SetTableName(dao.TableName).SetKey(keyAttrs).
 		SetReturnValues(dynamodb.ReturnValueAllOld)
+	return dao.deleteItem(keyAttrs, deleteItem)
+}
 
-	response, err := dao.Client.DeleteItem(deleteItem)
+// Sends the delete of the item with the key, returning the item deleted or nil if there wasn't one.
+func (dao *DynamoDBDao) deleteItem(keyAttrs map[string]*dynamodb.AttributeValue,
+	deleteItem *dynamodb.DeleteItemInput) (interface{}, error) {
+	output, err := dao.send(OperationDeleteItem, "", deleteItem, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.DeleteItemWithContext(aws.BackgroundContext(), deleteItem, reqOpts...)
+	})
 	if err != nil {
-		log.Printf("ERROR: %+v: %+v", err, response)
 		return nil, err
 	}
-	if len(response.Attributes) > 0 {
-		ptrT, err := dao.UnmarshalAttributes(response.Attributes)
-		if err != nil {
-			log.Printf("ERROR: %+v: %+v", err, response)
-			return nil, err
-		}
-		return ptrT, nil
-	}
-	return nil, nil
+	dao.cacheItem(keyAttrs, nil)
+	return dao.unmarshalReturned(OperationDeleteItem, output.(*dynamodb.DeleteItemOutput).Attributes)
 }
 
 func to_struct_ptr(obj interface{}) interface{} {
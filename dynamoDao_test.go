@@ -1,8 +1,10 @@
 package dynamoDao
 
 import (
+	"errors"
 	"github.com/danapsimer/dynamoDao/uuid"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
@@ -32,6 +34,47 @@ func resetTable(t *testing.T) {
 	}
 }
 
+// Returns a DAO of the struct type for the table without creating it, for the tests that don't talk to DynamoDB.
+func newTestDao(t *testing.T, tableName string, structType reflect.Type) *DynamoDBDao {
+	dao, err := NewDynamoDBDao(session.New(awsConfig), tableName, 0, 0, false, "", structType)
+	require.NoError(t, err)
+	return dao
+}
+
+// An interceptor that records the input of every request and answers it with the item given, if any, instead of
+// sending it.  Conditional updates fail if conditionFailed is set.
+type requestRecorder struct {
+	inputs          []interface{}
+	item            map[string]*dynamodb.AttributeValue
+	conditionFailed bool
+}
+
+func (recorder *requestRecorder) intercept(request *Request, next func() (interface{}, error)) (interface{}, error) {
+	recorder.inputs = append(recorder.inputs, request.Input)
+	items := make([]map[string]*dynamodb.AttributeValue, 0, 1)
+	if recorder.item != nil {
+		items = append(items, recorder.item)
+	}
+	switch request.Input.(type) {
+	case *dynamodb.PutItemInput:
+		return new(dynamodb.PutItemOutput), nil
+	case *dynamodb.GetItemInput:
+		return new(dynamodb.GetItemOutput).SetItem(recorder.item), nil
+	case *dynamodb.UpdateItemInput:
+		if recorder.conditionFailed {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+		}
+		return new(dynamodb.UpdateItemOutput).SetAttributes(recorder.item), nil
+	case *dynamodb.DeleteItemInput:
+		return new(dynamodb.DeleteItemOutput).SetAttributes(recorder.item), nil
+	case *dynamodb.QueryInput:
+		return new(dynamodb.QueryOutput).SetCount(int64(len(items))).SetItems(items), nil
+	case *dynamodb.ScanInput:
+		return new(dynamodb.ScanOutput).SetCount(int64(len(items))).SetItems(items), nil
+	}
+	return nil, errors.New("unexpected request")
+}
+
 type Struct1 struct {
 	Id          *uuid.UUID `dynamodbav:"person_id" dynamoKey:"hash"`
 	OrgId       uuid.UUID  `dynamodbav:"organization_id" dynamoGSI:"PhoneNumberIdx,hash"`
@@ -0,0 +1,111 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+// The kinds of errors returned by the DAO, to be tested for with errors.Is.  The errors returned are usually *DaoError
+// values carrying the table, index and operation, and wrapping the underlying error (e.g. an awserr.Error, which
+// errors.As finds).
+var (
+	// ErrNotFound is returned by GetItem when there is no item with the key, if the DAO is set to (see
+	// SetNotFoundError).  By default GetItem returns a nil item instead.
+	ErrNotFound = errors.New("item not found")
+	// ErrConditionFailed is returned when the condition of a write is not met.
+	ErrConditionFailed = errors.New("condition failed")
+	// ErrThrottled is returned when a request is throttled, after any retries, or is failed fast by the circuit breaker
+	// of the DAO's RetryPolicy.
+	ErrThrottled = errors.New("throttled")
+	// ErrValidation is returned when an item fails validation (see Validate), or DynamoDB rejects a request as invalid.
+	ErrValidation = errors.New("validation failed")
+	// ErrTableNotActive is returned when the table or index does not exist, is being created or updated, or does not
+	// become active in time.
+	ErrTableNotActive = errors.New("table not active")
+	// ErrSchemaMismatch is returned when the key schema of the table does not match that of the DAO's struct type.
+	ErrSchemaMismatch = errors.New("schema mismatch")
+	// ErrCrossTenant is returned by a DAO scoped to a tenant (see ForTenant) for an item, key or query of another
+	// tenant, and for scans and stream reads, which would cross tenants.
+	ErrCrossTenant = errors.New("cross-tenant access")
+)
+
+// DaoError is an error of an operation on a table or one of its indexes.  Kind is one of the Err variables above, or
+// nil if the error is of none of those kinds, and Err is the underlying error, if there is one.
+type DaoError struct {
+	Table     string
+	Index     string
+	Operation string
+	Kind      error
+	Err       error
+}
+
+func (e *DaoError) Error() string {
+	message := e.Operation + " " + e.Table
+	if e.Index != "" {
+		message += "." + e.Index
+	}
+	if e.Kind != nil && (e.Err == nil || !strings.HasPrefix(e.Err.Error(), e.Kind.Error())) {
+		message += ": " + e.Kind.Error()
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+func (e *DaoError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DaoError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// ValidationError is an ErrValidation.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Wraps the error of the operation with its context, unless it already has it.
+func (dao *DynamoDBDao) wrapError(operation, indexName string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var daoErr *DaoError
+	if errors.As(err, &daoErr) {
+		return err
+	}
+	return &DaoError{Table: dao.TableName, Index: indexName, Operation: operation, Kind: errorKind(err), Err: err}
+}
+
+// Returns the kind of error DynamoDB's error is, nil if it is none of them.
+func errorKind(err error) error {
+	if err == ErrCircuitOpen || request.IsErrorThrottle(err) {
+		return ErrThrottled
+	}
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return nil
+	}
+	switch awsErr.Code() {
+	case dynamodb.ErrCodeConditionalCheckFailedException:
+		return ErrConditionFailed
+	case dynamodb.ErrCodeResourceNotFoundException, dynamodb.ErrCodeResourceInUseException:
+		return ErrTableNotActive
+	case "ValidationException":
+		if strings.Contains(awsErr.Message(), "does not match the schema") {
+			return ErrSchemaMismatch
+		}
+		return ErrValidation
+	}
+	return nil
+}
+
+// Sets whether GetItem returns ErrNotFound, rather than a nil item, when there is no item with the key.
+func (dao *DynamoDBDao) SetNotFoundError(notFoundError bool) *DynamoDBDao {
+	dao.notFoundError = notFoundError
+	return dao
+}
@@ -0,0 +1,96 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		kind error
+	}{
+		{awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "no", nil), ErrConditionFailed},
+		{awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil), ErrThrottled},
+		{awserr.New("ThrottlingException", "slow down", nil), ErrThrottled},
+		{ErrCircuitOpen, ErrThrottled},
+		{awserr.New(dynamodb.ErrCodeResourceNotFoundException, "no table", nil), ErrTableNotActive},
+		{awserr.New(dynamodb.ErrCodeResourceInUseException, "busy", nil), ErrTableNotActive},
+		{awserr.New("ValidationException", "The provided key element does not match the schema", nil),
+			ErrSchemaMismatch},
+		{awserr.New("ValidationException", "Invalid FilterExpression", nil), ErrValidation},
+		{awserr.New("InternalServerError", "oops", nil), nil},
+		{errors.New("other"), nil},
+	} {
+		assert.Equal(t, test.kind, errorKind(test.err), test.err.Error())
+	}
+}
+
+func TestDaoError(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	cause := awserr.NewRequestFailure(
+		awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed", nil), 400, "1")
+	err := dao.wrapError(OperationQuery, "Email", cause)
+	assert.EqualError(t, err, "Query Struct3.Email: condition failed: "+cause.Error())
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+	assert.False(t, errors.Is(err, ErrThrottled))
+	var awsErr awserr.Error
+	require.True(t, errors.As(err, &awsErr))
+	assert.Equal(t, dynamodb.ErrCodeConditionalCheckFailedException, awsErr.Code())
+	var daoErr *DaoError
+	require.True(t, errors.As(err, &daoErr))
+	assert.Equal(t, "Struct3", daoErr.Table)
+	assert.Equal(t, "Email", daoErr.Index)
+	assert.Equal(t, OperationQuery, daoErr.Operation)
+
+	// Errors are only wrapped once.
+	assert.True(t, err == dao.wrapError(OperationGetItem, "", err))
+	assert.Nil(t, dao.wrapError(OperationGetItem, "", nil))
+
+	// The kind is not repeated when the underlying error already starts with it.
+	validationErr := &ValidationError{Violations: []FieldViolation{{Field: "id", Rule: ValidateRequired,
+		Message: "is required"}}}
+	err = dao.wrapError(OperationPutItem, "", validationErr)
+	assert.EqualError(t, err, "PutItem Struct3: validation failed: id is required")
+	assert.True(t, errors.Is(err, ErrValidation))
+	assert.True(t, errors.Is(validationErr, ErrValidation))
+	var violations *ValidationError
+	require.True(t, errors.As(err, &violations))
+	assert.Equal(t, "id", violations.Violations[0].Field)
+}
+
+func TestNotFoundError(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	dao.AddInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+		return new(dynamodb.GetItemOutput), nil
+	})
+	item, err := dao.GetItem(&Struct3{OrgId: "org", Id: "1"})
+	require.NoError(t, err)
+	assert.Nil(t, item)
+
+	dao.SetNotFoundError(true)
+	item, err = dao.GetItem(&Struct3{OrgId: "org", Id: "1"})
+	assert.Nil(t, item)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.EqualError(t, err, "GetItem Struct3: item not found")
+}
+
+func TestSchemaMismatch(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	current := new(dynamodb.DescribeTableOutput).SetTable(new(dynamodb.TableDescription).SetKeySchema(
+		[]*dynamodb.KeySchemaElement{
+			new(dynamodb.KeySchemaElement).SetAttributeName("id").SetKeyType(dynamodb.KeyTypeHash),
+		}))
+	promise := make(chan error, 1)
+	err := dao.updateTable(dao.tableDescription, current, promise)
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+	assert.Equal(t, err, <-promise)
+	assert.Contains(t, err.Error(), "UpdateTable Struct3: schema mismatch: the key schema")
+	assert.Equal(t, "Struct3", aws.StringValue(dao.tableDescription.TableName))
+}
@@ -0,0 +1,281 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// An attribute path in an expression, e.g. {a}, {Address.City}, {Address}.{City}, {Tags[0]} or {Tags}[0].{Name}.
+	attrNameTokenRegex = regexp.MustCompile("^\\{[^}]+\\}(\\[\\d+\\])*(\\.\\{[^}]+\\}(\\[\\d+\\])*)*")
+	// A name in an expression: anything up to whitespace, an operator, or punctuation.
+	expressionNameRegex = regexp.MustCompile("^[^\\s{}\\[\\]().,:#=<>]+")
+	// An attribute path in an expression that is not surrounded by {}, e.g. name, address.city or tags[0].
+	bareAttrPathRegex = regexp.MustCompile("^[^\\s{}\\[\\]().,:#=<>]+(\\[\\d+\\])*(\\.[^\\s{}\\[\\]().,:#=<>]+(\\[\\d+\\])*)*")
+	// An attribute name DynamoDB accepts in an expression without an alias, unless it is a reserved word.
+	plainAttrNameRegex = regexp.MustCompile("^[A-Za-z][A-Za-z0-9_]*$")
+	// The list indexes following the name of an element of an attribute path.
+	listIndexesRegex = regexp.MustCompile("^(\\[\\d+\\])*$")
+)
+
+// The keywords of the condition expression syntax.  They are reserved words, but must not be aliased.
+var expressionKeywords = map[string]bool{"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "IN": true}
+
+// An element of an attribute path: the name of a map entry or struct field and the list indexes that follow it, e.g.
+// tags[0][1] is the name tags with the indexes [0][1].
+type attrPathElement struct {
+	name    string
+	indexes string
+}
+
+// Replaces the attribute names surrounded by {} in the expression with aliases, adding them to attrNames.  A name may
+// be either a Go field name (e.g. {PhoneNumber}) or an attribute name (e.g. {phone_number}), nested fields are referred
+// to by their path (e.g. {Address.City} or {Address}.{City}), and list elements by their index (e.g. {Tags[0]} or
+// {Tags}[0]).  An error naming the attribute is returned if it is not an attribute of the DAO's struct type.
+//
+// Bare attribute names are left as they are unless they are reserved words (e.g. name) or contain special characters
+// (e.g. first-name), in which case they are aliased as well.  Each element of a bare path is considered separately, so
+// address.name becomes address.#A.  The keywords of the expression syntax (and, or, not, between, in) and function
+// names are never aliased.
+func (dao *DynamoDBDao) extractAttrNameAliasesFromExpression(expression string,
+	attrNames map[string]*string) (string, error) {
+	aliased := new(strings.Builder)
+	for i := 0; i < len(expression); {
+		switch c := expression[i]; {
+		case c == '{':
+			attrNameToken := attrNameTokenRegex.FindString(expression[i:])
+			if attrNameToken == "" {
+				aliased.WriteByte(c)
+				i++
+				continue
+			}
+			name := strings.NewReplacer("{", "", "}", "").Replace(attrNameToken)
+			attrPath, err := dao.resolveAttributeName(name)
+			if err != nil {
+				return "", fmt.Errorf("unknown attribute %s in expression: %s", name, expression)
+			}
+			aliased.WriteString(aliasAttrPath(attrPath, attrNames))
+			i += len(attrNameToken)
+		case c == ':' || c == '#':
+			// Value placeholders and explicit aliases are left alone.
+			token := expressionNameRegex.FindString(expression[i+1:])
+			aliased.WriteString(expression[i : i+1+len(token)])
+			i += 1 + len(token)
+		case expressionNameRegex.MatchString(expression[i : i+1]):
+			bareAttrPath := bareAttrPathRegex.FindString(expression[i:])
+			i += len(bareAttrPath)
+			aliased.WriteString(aliasBareAttrPath(bareAttrPath, expression[i:], attrNames))
+		default:
+			aliased.WriteByte(c)
+			i++
+		}
+	}
+	return aliased.String(), nil
+}
+
+// Aliases the elements of a bare attribute path that DynamoDB would not accept as they are.  The rest of the expression
+// is needed to tell function names, which are followed by '(', from attribute names.
+func aliasBareAttrPath(bareAttrPath, rest string, attrNames map[string]*string) string {
+	if strings.HasPrefix(strings.TrimLeft(rest, " \t\r\n"), "(") || expressionKeywords[strings.ToUpper(bareAttrPath)] {
+		return bareAttrPath
+	}
+	elements, ok := parseAttrPath(bareAttrPath)
+	if !ok {
+		return bareAttrPath
+	}
+	for i, element := range elements {
+		if reservedWords[strings.ToUpper(element.name)] || !plainAttrNameRegex.MatchString(element.name) {
+			elements[i].name = aliasAttrName(element.name, attrNames)
+		}
+	}
+	return formatAttrPath(elements)
+}
+
+// Resolves a path of Go field names (e.g. Address.City or Tags[0]) or attribute names (e.g. address.city or tags[0]),
+// or a mix of both, to the attribute path used in DynamoDB.  The path is checked against the DAO's struct type: each
+// element must name a field of the struct it is in, an index may only follow a slice or array, and an element may only
+// follow a struct, map or interface{}.  The keys of maps and everything below an interface{} are not checked.  The
+// attributes declared by key templates (e.g. pk=USER#{Id}) and the discriminator attribute are resolved to
+// themselves, and paths that are not in the DAO's struct type are checked against the types registered with it (see
+// RegisterType), in the order of their discriminators.
+func (dao *DynamoDBDao) resolveAttributeName(name string) (string, error) {
+	if dao.keyTemplate(name) != nil || name != "" && name == dao.typeAttribute {
+		return name, nil
+	}
+	if attrPath, ok := resolveAttributeNameIn(dao.structType, name); ok {
+		return attrPath, nil
+	}
+	discriminators := make([]string, 0, len(dao.types))
+	for discriminator := range dao.types {
+		discriminators = append(discriminators, discriminator)
+	}
+	sort.Strings(discriminators)
+	for _, discriminator := range discriminators {
+		if attrPath, ok := resolveAttributeNameIn(dao.types[discriminator].structType, name); ok {
+			return attrPath, nil
+		}
+	}
+	return "", errors.New("unknown field or attribute: " + name)
+}
+
+func resolveAttributeNameIn(structType reflect.Type, name string) (string, bool) {
+	elements, ok := parseAttrPath(name)
+	if !ok {
+		return "", false
+	}
+	typ := structType
+	for i, element := range elements {
+		typ = derefType(typ)
+		switch {
+		case typ.Kind() == reflect.Interface:
+		case typ.Kind() == reflect.Map:
+			typ = typ.Elem()
+		case typ.Kind() == reflect.Struct && mapToScalarType(typ) == "":
+			field, attrName, found := findAttributeField(typ, element.name)
+			if !found {
+				return "", false
+			}
+			elements[i].name = attrName
+			typ = field.Type
+		default:
+			return "", false
+		}
+		for n := strings.Count(element.indexes, "["); n > 0; n-- {
+			typ = derefType(typ)
+			switch {
+			case typ.Kind() == reflect.Interface:
+			case (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && typ.Elem().Kind() != reflect.Uint8:
+				typ = typ.Elem()
+			default:
+				return "", false
+			}
+		}
+	}
+	return formatAttrPath(elements), true
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// Finds the field of the struct with the given attribute name or, failing that, Go field name.  The fields of embedded
+// structs without an attribute name of their own are marshaled inline, so they are searched as well.
+func findAttributeField(structType reflect.Type, name string) (reflect.StructField, string, bool) {
+	if field, found := findAttributeFieldBy(structType, name, func(field reflect.StructField) string {
+		return getFieldName("", field)
+	}); found {
+		return field, getFieldName("", field), true
+	}
+	if field, found := findAttributeFieldBy(structType, name, func(field reflect.StructField) string {
+		return field.Name
+	}); found {
+		return field, getFieldName("", field), true
+	}
+	return reflect.StructField{}, "", false
+}
+
+func findAttributeFieldBy(structType reflect.Type, name string,
+	fieldName func(reflect.StructField) string) (reflect.StructField, bool) {
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		if getFieldName("", field) == "-" {
+			continue
+		}
+		if field.Anonymous && getFieldName("", field) == field.Name {
+			embeddedType := derefType(field.Type)
+			if embeddedType.Kind() == reflect.Struct && mapToScalarType(embeddedType) == "" {
+				if embedded, found := findAttributeFieldBy(embeddedType, name, fieldName); found {
+					return embedded, true
+				}
+				continue
+			}
+		}
+		if field.PkgPath == "" && fieldName(field) == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Splits an attribute path into its elements, returning false if it is malformed.
+func parseAttrPath(attrPath string) ([]attrPathElement, bool) {
+	parts := strings.Split(attrPath, ".")
+	elements := make([]attrPathElement, len(parts))
+	for i, part := range parts {
+		name, indexes := part, ""
+		if bracket := strings.Index(part, "["); bracket >= 0 {
+			name, indexes = part[:bracket], part[bracket:]
+		}
+		if name == "" || !listIndexesRegex.MatchString(indexes) {
+			return nil, false
+		}
+		elements[i] = attrPathElement{name: name, indexes: indexes}
+	}
+	return elements, true
+}
+
+func formatAttrPath(elements []attrPathElement) string {
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		parts[i] = element.name + element.indexes
+	}
+	return strings.Join(parts, ".")
+}
+
+// Converts an attribute path (e.g. address.city or tags[0]) to the expression that refers to it with each element
+// aliased (e.g. {address}.{city} or {tags}[0]).
+func attrPathExpression(attrPath string) string {
+	elements, ok := parseAttrPath(attrPath)
+	if !ok {
+		return "{" + attrPath + "}"
+	}
+	parts := make([]string, len(elements))
+	for i, element := range elements {
+		parts[i] = "{" + element.name + "}" + element.indexes
+	}
+	return strings.Join(parts, ".")
+}
+
+// Aliases the name of each element of the attribute path (e.g. address.city becomes #A.#B and tags[0] becomes #C[0]),
+// reusing any aliases already in attrNames.
+func aliasAttrPath(attrPath string, attrNames map[string]*string) string {
+	elements, ok := parseAttrPath(attrPath)
+	if !ok {
+		return aliasAttrName(attrPath, attrNames)
+	}
+	for i, element := range elements {
+		elements[i].name = aliasAttrName(element.name, attrNames)
+	}
+	return formatAttrPath(elements)
+}
+
+func aliasAttrName(attrName string, attrNames map[string]*string) string {
+	for alias, attrNamePtr := range attrNames {
+		if *attrNamePtr == attrName {
+			return alias
+		}
+	}
+	for i := len(attrNames); ; i++ {
+		alias := attrNameAlias(i)
+		if _, taken := attrNames[alias]; !taken {
+			attrNames[alias] = &attrName
+			return alias
+		}
+	}
+}
+
+// Returns the i'th alias: #A through #Z, then #AA through #ZZ, then #AAA and so on.
+func attrNameAlias(i int) string {
+	name := make([]byte, 0, 4)
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return "#" + string(name)
+}
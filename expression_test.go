@@ -0,0 +1,148 @@
+package dynamoDao
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Address struct {
+	Street string `dynamodbav:"street"`
+	City   string `dynamodbav:"city"`
+}
+
+type Audit struct {
+	CreatedBy string `dynamodbav:"created_by"`
+}
+
+type Person struct {
+	Audit
+	Id        string                 `dynamoKey:"hash" dynamodbav:"id"`
+	Address   *Address               `dynamodbav:"address"`
+	Addresses []Address              `dynamodbav:"addresses"`
+	Tags      []string               `dynamodbav:"tags"`
+	Matrix    [][]int                `dynamodbav:"matrix"`
+	Labels    map[string]string      `dynamodbav:"labels"`
+	Extra     map[string]interface{} `dynamodbav:"extra"`
+	Photo     []byte                 `dynamodbav:"photo"`
+	Secret    string                 `dynamodbav:"-"`
+}
+
+func TestResolveAttributeName(t *testing.T) {
+	dao := newTestDao(t, "Person", reflect.TypeOf(Person{}))
+
+	for name, expected := range map[string]string{
+		"Id":                  "id",
+		"Address.City":        "address.city",
+		"address.City":        "address.city",
+		"Addresses[1].Street": "addresses[1].street",
+		"Tags[0]":             "tags[0]",
+		"Matrix[2][3]":        "matrix[2][3]",
+		"Labels.color":        "labels.color",
+		"Extra.any[4].thing":  "extra.any[4].thing",
+		"CreatedBy":           "created_by",
+		"created_by":          "created_by",
+		"Photo":               "photo",
+	} {
+		attrPath, err := dao.resolveAttributeName(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, expected, attrPath, name)
+		}
+	}
+
+	for _, name := range []string{"Nope", "Secret", "Id.Nope", "Address[0]", "Tags[0][1]", "Matrix[0][0][0]",
+		"Photo[0]", "Tags[x]", "Address..City", "Audit", "[0]"} {
+		_, err := dao.resolveAttributeName(name)
+		assert.EqualError(t, err, "unknown field or attribute: "+name)
+	}
+}
+
+func TestExtractAttrNameAliasesFromNestedPaths(t *testing.T) {
+	dao := newTestDao(t, "Person", reflect.TypeOf(Person{}))
+
+	attrNames := make(map[string]*string)
+	expression, err := dao.extractAttrNameAliasesFromExpression(
+		"{Address.City} = :c and {Tags[0]} = :t and {Addresses}[1].{Street} = :s and {Matrix[0][1]} > :m", attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "#A.#B = :c and #C[0] = :t and #D[1].#E = :s and #F[0][1] > :m", expression)
+	assert.Equal(t, "address", *attrNames["#A"])
+	assert.Equal(t, "city", *attrNames["#B"])
+	assert.Equal(t, "tags", *attrNames["#C"])
+	assert.Equal(t, "addresses", *attrNames["#D"])
+	assert.Equal(t, "street", *attrNames["#E"])
+	assert.Equal(t, "matrix", *attrNames["#F"])
+
+	_, err = dao.extractAttrNameAliasesFromExpression("{Address[0]} = :a", attrNames)
+	assert.EqualError(t, err, "unknown attribute Address[0] in expression: {Address[0]} = :a")
+}
+
+func TestExtractAttrNameAliasesWithManyNames(t *testing.T) {
+	dao := newTestDao(t, "Person", reflect.TypeOf(Person{}))
+
+	conditions := make([]string, 100)
+	for i := range conditions {
+		conditions[i] = fmt.Sprintf("{Labels.label%d} = :v%d", i, i)
+	}
+	attrNames := make(map[string]*string)
+	expression, err := dao.extractAttrNameAliasesFromExpression(strings.Join(conditions, " and "), attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, 101, len(attrNames))
+	assert.Equal(t, "labels", *attrNames["#A"])
+	assert.Equal(t, "label24", *attrNames["#Z"])
+	assert.Equal(t, "label25", *attrNames["#AA"])
+	assert.Equal(t, "label99", *attrNames["#CW"])
+	assert.True(t, strings.HasSuffix(expression, "#A.#CW = :v99"))
+}
+
+func TestAttrNameAlias(t *testing.T) {
+	assert.Equal(t, "#A", attrNameAlias(0))
+	assert.Equal(t, "#Z", attrNameAlias(25))
+	assert.Equal(t, "#AA", attrNameAlias(26))
+	assert.Equal(t, "#AZ", attrNameAlias(51))
+	assert.Equal(t, "#BA", attrNameAlias(52))
+	assert.Equal(t, "#ZZ", attrNameAlias(701))
+	assert.Equal(t, "#AAA", attrNameAlias(702))
+}
+
+func TestAttrPathExpression(t *testing.T) {
+	assert.Equal(t, "{a}", attrPathExpression("a"))
+	assert.Equal(t, "{address}.{city}", attrPathExpression("address.city"))
+	assert.Equal(t, "{addresses}[1].{street}", attrPathExpression("addresses[1].street"))
+}
+
+func TestExtractAttrNameAliasesFromBareNames(t *testing.T) {
+	dao := newTestDao(t, "Person", reflect.TypeOf(Person{}))
+
+	attrNames := make(map[string]*string)
+	expression, err := dao.extractAttrNameAliasesFromExpression(
+		"id = :id AND name = :n and address.name <> :a and first-name = :f and #x = :x", attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "id = :id AND #A = :n and address.#A <> :a and #B = :f and #x = :x", expression)
+	assert.Equal(t, 2, len(attrNames))
+	assert.Equal(t, "name", *attrNames["#A"])
+	assert.Equal(t, "first-name", *attrNames["#B"])
+
+	attrNames = make(map[string]*string)
+	expression, err = dao.extractAttrNameAliasesFromExpression(
+		"size(tags) > :s AND begins_with ( status, :p ) AND NOT attribute_exists(data[0].Count) AND "+
+			"Year BETWEEN :y1 AND :y2 AND tags IN (:t1, :t2) OR {Address}.city = :c", attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "size(tags) > :s AND begins_with ( #A, :p ) AND NOT attribute_exists(#B[0].#C) AND "+
+		"#D BETWEEN :y1 AND :y2 AND tags IN (:t1, :t2) OR #E.city = :c", expression)
+	assert.Equal(t, "status", *attrNames["#A"])
+	assert.Equal(t, "data", *attrNames["#B"])
+	assert.Equal(t, "Count", *attrNames["#C"])
+	assert.Equal(t, "Year", *attrNames["#D"])
+	assert.Equal(t, "address", *attrNames["#E"])
+}
+
+func TestReservedWords(t *testing.T) {
+	assert.Equal(t, 573, len(reservedWords))
+	for _, word := range []string{"ABORT", "NAME", "STATUS", "DATA", "COUNT", "ZONE"} {
+		assert.True(t, reservedWords[word], word)
+	}
+	assert.False(t, reservedWords["PHONE"])
+}
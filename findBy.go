@@ -0,0 +1,181 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AllowScan lets FindBy fall back to a scan of the table when no index can answer the search.
+func AllowScan() ReadOption {
+	return func(ro *readOptions) {
+		ro.allowScan = true
+	}
+}
+
+// A table or index FindBy could query and how well it matches the example.
+type findByCandidate struct {
+	indexName string
+	hashKey   string
+	rangeKey  string
+	score     int
+}
+
+// Finds the items equal to the example, which is either a partially populated struct, whose non-zero top-level fields
+// are used, or a map of Go field or attribute names to values.  The attributes built from key templates are used as well
+// when all of the fields they are built from are given.  The table, global secondary index, or local secondary index
+// whose key schema best matches the example is queried, preferring those matching both the hash and range key, and
+// then the table over local indexes over global indexes.  Only indexes that project all attributes are considered.
+// The remaining values are applied as a filter.  If no table or index can be queried, an error is returned unless the
+// AllowScan option is given, in which case the table is scanned.
+func (dao *DynamoDBDao) FindBy(example interface{}, lastItemToken *string, pageOffset, pageSize int64,
+	opts ...ReadOption) (*SearchPage, error) {
+	ro := newReadOptions(opts)
+	conditions, err := dao.exampleConditions(example)
+	if err != nil {
+		return nil, err
+	}
+	candidate := dao.bestIndexFor(conditions)
+	if candidate == nil {
+		if !ro.allowScan {
+			return nil, errors.New("no table or index key matches the example, use the AllowScan option to scan")
+		}
+		qb := dao.Query()
+		addFilterConditions(qb, conditions, nil)
+		return dao.pagedScan("", strings.Join(qb.filterConditions, " and "), qb.queryValues, lastItemToken,
+			pageOffset, pageSize, opts...)
+	}
+	qb := dao.Query().Index(candidate.indexName).Key(candidate.hashKey).Eq(conditions[candidate.hashKey])
+	if candidate.score > 1 {
+		qb = qb.Range(candidate.rangeKey).Eq(conditions[candidate.rangeKey])
+	}
+	addFilterConditions(qb, conditions, candidate)
+	return qb.StartAfter(lastItemToken).Offset(pageOffset).Limit(pageSize).Options(opts...).Execute()
+}
+
+func addFilterConditions(qb *QueryBuilder, conditions map[string]interface{}, candidate *findByCandidate) {
+	attrPaths := make([]string, 0, len(conditions))
+	for attrPath := range conditions {
+		if candidate == nil || attrPath != candidate.hashKey && (candidate.score < 2 || attrPath != candidate.rangeKey) {
+			attrPaths = append(attrPaths, attrPath)
+		}
+	}
+	sort.Strings(attrPaths)
+	for _, attrPath := range attrPaths {
+		qb.Filter(attrPath).Eq(conditions[attrPath])
+	}
+}
+
+// Converts the example to a map of attribute paths to the values they must be equal to.
+func (dao *DynamoDBDao) exampleConditions(example interface{}) (map[string]interface{}, error) {
+	conditions := make(map[string]interface{})
+	if fields, ok := example.(map[string]interface{}); ok {
+		for field, v := range fields {
+			attrPath, err := dao.resolveAttributeName(field)
+			if err != nil {
+				return nil, err
+			}
+			conditions[attrPath] = v
+		}
+		return conditions, nil
+	}
+	value := reflect.ValueOf(example)
+	if value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, errors.New("example must be a struct or a map[string]interface{}")
+	}
+	for f := 0; f < value.NumField(); f++ {
+		field := value.Type().Field(f)
+		attrName := getFieldName("", field)
+		if field.PkgPath != "" || attrName == "-" || value.Field(f).IsZero() {
+			continue
+		}
+		// Marshal through a pointer so marshalers with pointer receivers, like uuid.UUID's, are used.
+		ptr := reflect.New(field.Type)
+		ptr.Elem().Set(value.Field(f))
+		conditions[attrName] = ptr.Interface()
+	}
+	// The attributes built from key templates can be searched on once all of the fields they are built from are given.
+	_, keyTemplates, _ := dao.structValue(example)
+	for _, kt := range keyTemplates {
+		complete := true
+		for _, field := range kt.fields {
+			complete = complete && !value.FieldByIndex(field.Index).IsZero()
+		}
+		if complete {
+			attrValue, err := kt.format(value)
+			if err != nil {
+				return nil, err
+			}
+			conditions[kt.attrName] = attrValue
+		}
+	}
+	return conditions, nil
+}
+
+// Picks the table or index best able to answer a search for the given conditions, nil if none can.
+func (dao *DynamoDBDao) bestIndexFor(conditions map[string]interface{}) *findByCandidate {
+	return dao.bestIndexForKeys(conditions, conditions)
+}
+
+// Picks the table or index best able to answer a search with equality conditions on the hashConditions attributes and
+// key conditions (e.g. > or begins_with) on the rangeConditions attributes, nil if none can.
+func (dao *DynamoDBDao) bestIndexForKeys(hashConditions, rangeConditions map[string]interface{}) *findByCandidate {
+	candidates := []*findByCandidate{dao.indexCandidate("", dao.tableDescription.KeySchema, hashConditions,
+		rangeConditions)}
+	// The indexes are ordered by name so the same one is picked every time when several match equally well.
+	localCandidates := make([]*findByCandidate, 0, len(dao.tableDescription.LocalSecondaryIndexes))
+	for _, lsi := range dao.tableDescription.LocalSecondaryIndexes {
+		if *lsi.Projection.ProjectionType == dynamodb.ProjectionTypeAll {
+			localCandidates = append(localCandidates, dao.indexCandidate(*lsi.IndexName, lsi.KeySchema,
+				hashConditions, rangeConditions))
+		}
+	}
+	sort.Slice(localCandidates, func(i, j int) bool {
+		return localCandidates[i].indexName < localCandidates[j].indexName
+	})
+	globalCandidates := make([]*findByCandidate, 0, len(dao.tableDescription.GlobalSecondaryIndexes))
+	for _, gsi := range dao.tableDescription.GlobalSecondaryIndexes {
+		if *gsi.Projection.ProjectionType == dynamodb.ProjectionTypeAll {
+			globalCandidates = append(globalCandidates, dao.indexCandidate(*gsi.IndexName, gsi.KeySchema,
+				hashConditions, rangeConditions))
+		}
+	}
+	sort.Slice(globalCandidates, func(i, j int) bool {
+		return globalCandidates[i].indexName < globalCandidates[j].indexName
+	})
+	candidates = append(append(candidates, localCandidates...), globalCandidates...)
+	var best *findByCandidate
+	for _, candidate := range candidates {
+		if candidate.score > 0 && (best == nil || candidate.score > best.score) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// Scores the index: 0 if the hash key is not in the hash conditions, 1 if only it is, and 2 if the range key is in the
+// range conditions as well.
+func (dao *DynamoDBDao) indexCandidate(indexName string, keySchema []*dynamodb.KeySchemaElement,
+	hashConditions, rangeConditions map[string]interface{}) *findByCandidate {
+	candidate := &findByCandidate{indexName: indexName}
+	for _, ks := range keySchema {
+		switch *ks.KeyType {
+		case dynamodb.KeyTypeHash:
+			candidate.hashKey = *ks.AttributeName
+		case dynamodb.KeyTypeRange:
+			candidate.rangeKey = *ks.AttributeName
+		}
+	}
+	if _, ok := hashConditions[candidate.hashKey]; ok {
+		candidate.score = 1
+		if _, ok := rangeConditions[candidate.rangeKey]; ok && candidate.rangeKey != "" {
+			candidate.score = 2
+		}
+	}
+	return candidate
+}
@@ -0,0 +1,83 @@
+package dynamoDao
+
+import (
+	"github.com/danapsimer/dynamoDao/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestExampleConditions(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	conditions, err := dao.exampleConditions(&TestStruct{A: "1", C: 2.5, M: "ignored"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(conditions))
+	assert.Equal(t, "1", *conditions["a"].(*string))
+	assert.Equal(t, float32(2.5), *conditions["c"].(*float32))
+
+	conditions, err = dao.exampleConditions(map[string]interface{}{"A": "1", "n": "bar", "F.G": "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "1", "n": "bar", "f.G": "foo"}, conditions)
+
+	_, err = dao.exampleConditions(map[string]interface{}{"Nope": 1})
+	assert.Error(t, err)
+	_, err = dao.exampleConditions("nope")
+	assert.Error(t, err)
+}
+
+func TestBestIndexFor(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	candidate := dao.bestIndexFor(map[string]interface{}{"a": "1", "B": 2})
+	require.NotNil(t, candidate)
+	assert.Equal(t, "", candidate.indexName)
+	assert.Equal(t, 2, candidate.score)
+
+	// Snafu only projects some attributes so FooBar is used.
+	candidate = dao.bestIndexFor(map[string]interface{}{"B": 2, "c": 1.5, "n": "bar"})
+	require.NotNil(t, candidate)
+	assert.Equal(t, "FooBar", candidate.indexName)
+	assert.Equal(t, 2, candidate.score)
+
+	assert.Nil(t, dao.bestIndexFor(map[string]interface{}{"n": "bar"}))
+
+	dao1 := newTestDao(t, "Struct1", reflect.TypeOf(Struct1{}))
+	orgId := uuid.NewV4()
+	conditions, err := dao1.exampleConditions(&Struct1{OrgId: orgId, Name: "Joe Blow"})
+	require.NoError(t, err)
+	candidate = dao1.bestIndexFor(conditions)
+	require.NotNil(t, candidate)
+	assert.Equal(t, "PhoneNumberIdx", candidate.indexName)
+	assert.Equal(t, 1, candidate.score)
+
+	qb := dao1.Query().Index(candidate.indexName).Key(candidate.hashKey).Eq(conditions[candidate.hashKey])
+	addFilterConditions(qb, conditions, candidate)
+	_, keyExpression, filterExpression, _, err := qb.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "{organization_id} = :v0", keyExpression)
+	assert.Equal(t, "{name} = :v1", filterExpression)
+}
+
+func TestDynamoDBDao_FindBy(t *testing.T) {
+	dao := setup(t)
+	orgId := uuid.NewV4()
+	for _, name := range []string{"Joe Blow", "Jane Doe"} {
+		id := uuid.NewV4()
+		_, err := dao.PutItem(&Struct1{Id: &id, OrgId: orgId, Name: name, PhoneNumber: "4045551212"})
+		require.NoError(t, err)
+	}
+
+	page, err := dao.FindBy(&Struct1{OrgId: orgId, Name: "Jane Doe"}, nil, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(page.Data))
+	assert.Equal(t, "Jane Doe", page.Data[0].(*Struct1).Name)
+
+	_, err = dao.FindBy(map[string]interface{}{"PhoneNumber": "4045551212"}, nil, 0, 10)
+	assert.Error(t, err)
+
+	page, err = dao.FindBy(map[string]interface{}{"PhoneNumber": "4045551212"}, nil, 0, 10, AllowScan())
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(page.Data))
+}
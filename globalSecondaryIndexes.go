@@ -49,13 +49,21 @@ func extractGlobalSecondaryIndexes(baseName string, structType reflect.Type, GSI
 	for f := 0; f < structType.NumField(); f++ {
 		field := structType.Field(f)
 		fieldName := getFieldName(baseName, field)
-		if fieldName == "-" {
+		dynamodDbDaoGSI, ok := field.Tag.Lookup(globalIndexTag)
+		if fieldName == "-" && !(ok && strings.Contains(dynamodDbDaoGSI, "=")) {
 			continue
 		}
 
-		if dynamodDbDaoGSI, ok := field.Tag.Lookup(globalIndexTag); ok {
+		if ok {
 			for _, gsiStr := range strings.Split(dynamodDbDaoGSI, ";") {
-				nameAndRole := strings.Split(gsiStr, ",")
+				nameAndRole, template := splitKeyTemplate(strings.Split(gsiStr, ","))
+				keyName := fieldName
+				if template != "" {
+					// The key is the attribute built from the template rather than the field.
+					keyName = template[:strings.Index(template, "=")]
+				} else if fieldName == "-" {
+					continue
+				}
 				indexName := nameAndRole[0]
 				role := nameAndRole[1]
 				gsi, ok := GSIs[indexName]
@@ -69,7 +77,7 @@ func extractGlobalSecondaryIndexes(baseName string, structType reflect.Type, GSI
 					if !allowKey {
 						return errors.New("hash not allowed on non-top-level fields.")
 					}
-					err := parseGSIHashKey(fieldName, nameAndRole, gsi)
+					err := parseGSIHashKey(keyName, nameAndRole, gsi)
 					if err != nil {
 						return err
 					}
@@ -77,7 +85,7 @@ func extractGlobalSecondaryIndexes(baseName string, structType reflect.Type, GSI
 					if !allowKey {
 						return errors.New("range not allowed on non-top-level fields.")
 					}
-					err := parseGSIRangeKey(fieldName, gsi)
+					err := parseGSIRangeKey(keyName, gsi)
 					if err != nil {
 						return err
 					}
@@ -0,0 +1,76 @@
+package dynamoDao
+
+import (
+	"reflect"
+)
+
+// BeforeSaver is implemented by item types that need to prepare themselves (e.g. normalize fields) before PutItem or
+// UpdateItem writes them.  An error aborts the write.
+type BeforeSaver interface {
+	BeforeSave() error
+}
+
+// AfterSaver is implemented by item types that need to act after PutItem or UpdateItem has written them.  For
+// UpdateItem it is called on the item returned, as it is now stored.  An error is returned by the write, although the
+// item has been written.
+type AfterSaver interface {
+	AfterSave() error
+}
+
+// AfterLoader is implemented by item types that need to finish themselves (e.g. denormalize fields) after being
+// unmarshaled by UnmarshalAttributes, which every read uses.  Projection types given to ProjectInto may implement it as
+// well.  An error aborts the read.
+type AfterLoader interface {
+	AfterLoad() error
+}
+
+// BeforeDeleter is implemented by key (usually item) types that need to act before DeleteItem deletes the item with
+// their key.  An error aborts the delete.
+type BeforeDeleter interface {
+	BeforeDelete() error
+}
+
+// Returns the item as a pointer so that hooks with pointer receivers are called and their changes seen: the item
+// itself if it is a pointer, otherwise a pointer to a copy of it.
+func hookTarget(t interface{}) interface{} {
+	if t == nil || reflect.TypeOf(t).Kind() == reflect.Ptr {
+		return t
+	}
+	return to_struct_ptr(t)
+}
+
+// Returns the hook target in the same form (pointer or value) as the original item.
+func hookResult(t, target interface{}) interface{} {
+	if t == nil || reflect.TypeOf(t).Kind() == reflect.Ptr {
+		return target
+	}
+	return reflect.ValueOf(target).Elem().Interface()
+}
+
+func beforeSave(item interface{}) error {
+	if saver, ok := item.(BeforeSaver); ok {
+		return saver.BeforeSave()
+	}
+	return nil
+}
+
+func afterSave(item interface{}) error {
+	if saver, ok := item.(AfterSaver); ok {
+		return saver.AfterSave()
+	}
+	return nil
+}
+
+func afterLoad(item interface{}) error {
+	if loader, ok := item.(AfterLoader); ok {
+		return loader.AfterLoad()
+	}
+	return nil
+}
+
+func beforeDelete(key interface{}) error {
+	if deleter, ok := key.(BeforeDeleter); ok {
+		return deleter.BeforeDelete()
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type HookedStruct struct {
+	Id         string `dynamodbav:"id" dynamoKey:"hash"`
+	Email      string `dynamodbav:"email"`
+	Domain     string `dynamodbav:"-"`
+	Saves      int    `dynamodbav:"-"`
+	Invalid    bool   `dynamodbav:"-"`
+	Protected  bool   `dynamodbav:"protected"`
+	LoadFailed bool   `dynamodbav:"load_failed"`
+}
+
+func (h *HookedStruct) BeforeSave() error {
+	if h.Invalid {
+		return errors.New("invalid")
+	}
+	h.Email = strings.ToLower(h.Email)
+	return nil
+}
+
+func (h *HookedStruct) AfterSave() error {
+	h.Saves++
+	return nil
+}
+
+func (h *HookedStruct) AfterLoad() error {
+	if h.LoadFailed {
+		return errors.New("load failed")
+	}
+	h.Domain = h.Email[strings.Index(h.Email, "@")+1:]
+	return nil
+}
+
+func (h *HookedStruct) BeforeDelete() error {
+	if h.Protected {
+		return fmt.Errorf("%s is protected", h.Id)
+	}
+	return nil
+}
+
+func TestHookTarget(t *testing.T) {
+	item := &HookedStruct{Id: "1"}
+	assert.True(t, hookTarget(item) == item)
+	assert.True(t, hookResult(item, item) == item)
+
+	target := hookTarget(HookedStruct{Id: "1"})
+	require.IsType(t, &HookedStruct{}, target)
+	target.(*HookedStruct).Id = "2"
+	assert.Equal(t, HookedStruct{Id: "2"}, hookResult(HookedStruct{}, target))
+}
+
+func TestHooksAbort(t *testing.T) {
+	dao := newTestDao(t, "HookedStruct", reflect.TypeOf(HookedStruct{}))
+
+	_, err := dao.PutItem(&HookedStruct{Id: "1", Invalid: true})
+	assert.EqualError(t, err, "invalid")
+	_, err = dao.UpdateItem(HookedStruct{Id: "1", Invalid: true})
+	assert.EqualError(t, err, "invalid")
+	_, err = dao.DeleteItem(HookedStruct{Id: "1", Protected: true})
+	assert.EqualError(t, err, "1 is protected")
+
+	attrs, err := dao.MarshalAttributes(&HookedStruct{Id: "1", Email: "joe@example.com"})
+	require.NoError(t, err)
+	item, err := dao.UnmarshalAttributes(attrs)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", item.(*HookedStruct).Domain)
+
+	attrs["load_failed"] = new(dynamodb.AttributeValue).SetBOOL(true)
+	_, err = dao.UnmarshalAttributes(attrs)
+	assert.EqualError(t, err, "load failed")
+}
+
+func TestDynamoDBDao_Hooks(t *testing.T) {
+	sess := session.New(awsConfig)
+	client := dynamodb.New(sess)
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("HookedStruct")})
+	if err == nil {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("HookedStruct")})
+		require.NoError(t, err)
+	}
+	dao, err := NewDynamoDBDaoForType(sess, reflect.TypeOf(HookedStruct{}))
+	require.NoError(t, err)
+
+	saved, err := dao.PutItem(HookedStruct{Id: "1", Email: "Joe@Example.COM"})
+	require.NoError(t, err)
+	assert.Equal(t, "joe@example.com", saved.(HookedStruct).Email)
+	assert.Equal(t, 1, saved.(HookedStruct).Saves)
+
+	loaded, err := dao.GetItem(&HookedStruct{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "example.com", loaded.(*HookedStruct).Domain)
+
+	updated, err := dao.UpdateItem(&HookedStruct{Id: "1", Email: "Joe@Other.ORG", Protected: true})
+	require.NoError(t, err)
+	assert.Equal(t, "other.org", updated.(*HookedStruct).Domain)
+	assert.Equal(t, 1, updated.(*HookedStruct).Saves)
+
+	_, err = dao.DeleteItem(updated)
+	assert.EqualError(t, err, "1 is protected")
+	_, err = dao.DeleteItem(&HookedStruct{Id: "1"})
+	require.NoError(t, err)
+}
@@ -0,0 +1,67 @@
+package dynamoDao
+
+import (
+	"errors"
+	"reflect"
+)
+
+// The table administration operations passed to interceptors along with the operations reported to a MetricsCollector.
+const (
+	OperationDescribeTable = "DescribeTable"
+	OperationCreateTable   = "CreateTable"
+	OperationUpdateTable   = "UpdateTable"
+)
+
+// Request is a request the DAO is about to send to DynamoDB.  Operation is one of the Operation constants and Input the
+// SDK's input for it, e.g. *dynamodb.GetItemInput for OperationGetItem or *dynamodb.QueryInput for OperationQuery and
+// OperationCountQuery.  Each page of a query or scan is a separate request.
+type Request struct {
+	Table     string
+	Index     string
+	Operation string
+	Input     interface{}
+}
+
+// Interceptor wraps the requests a DAO sends to DynamoDB (see AddInterceptors).  It is given the request and next,
+// which sends it (through the interceptors after this one), and must return the output of the request, e.g.
+// *dynamodb.GetItemOutput, or an error.  An interceptor may change the input before calling next, change the output or
+// error it returns, or not call next at all, e.g. to inject faults.
+type Interceptor func(request *Request, next func() (interface{}, error)) (interface{}, error)
+
+// Adds interceptors wrapping every request to DynamoDB, including the table administration requests made when the table
+// is created or updated (see WithInterceptors for those made by NewDynamoDBDaoForType).  The first interceptor added is
+// the outermost: it is called first and returns last.  Interceptors are called within the logging and metrics of the
+// request, so what they return is what is logged and reported.
+func (dao *DynamoDBDao) AddInterceptors(interceptors ...Interceptor) *DynamoDBDao {
+	dao.interceptors = append(dao.interceptors, interceptors...)
+	return dao
+}
+
+// WithInterceptors adds the interceptors to the DAO created by NewDynamoDBDaoForType before it creates or updates its
+// table.
+func WithInterceptors(interceptors ...Interceptor) DaoOption {
+	return func(dao *DynamoDBDao) {
+		dao.AddInterceptors(interceptors...)
+	}
+}
+
+// Calls the interceptors in order around the call.
+func (dao *DynamoDBDao) intercept(request *Request, call func() (interface{}, error)) (interface{}, error) {
+	if len(dao.interceptors) == 0 {
+		return call()
+	}
+	var next func(i int) (interface{}, error)
+	next = func(i int) (interface{}, error) {
+		if i == len(dao.interceptors) {
+			return call()
+		}
+		return dao.interceptors[i](request, func() (interface{}, error) {
+			return next(i + 1)
+		})
+	}
+	output, err := next(0)
+	if err == nil && (output == nil || reflect.ValueOf(output).Kind() == reflect.Ptr && reflect.ValueOf(output).IsNil()) {
+		return nil, errors.New("interceptor returned neither an output nor an error")
+	}
+	return output, err
+}
@@ -0,0 +1,87 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	collector := NewMemoryMetricsCollector()
+	dao.SetMetricsCollector(collector).SetLogger(nil)
+	calls := make([]string, 0)
+	dao.AddInterceptors(
+		func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+			calls = append(calls, "outer "+request.Operation+" "+request.Index)
+			output, err := next()
+			calls = append(calls, "outer done")
+			return output, err
+		},
+		func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+			calls = append(calls, "inner")
+			request.Input.(*dynamodb.QueryInput).SetLimit(5)
+			output, err := next()
+			if err == nil {
+				output.(*dynamodb.QueryOutput).SetCount(7)
+			}
+			return output, err
+		})
+
+	query := new(dynamodb.QueryInput)
+	output, err := dao.send(OperationQuery, "Email", query, func(...request.Option) (interface{}, error) {
+		calls = append(calls, "call")
+		assert.Equal(t, int64(5), aws.Int64Value(query.Limit))
+		return new(dynamodb.QueryOutput), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"outer Query Email", "inner", "call", "outer done"}, calls)
+	assert.Equal(t, int64(7), *output.(*dynamodb.QueryOutput).Count)
+	assert.Equal(t, int64(7), collector.Operations()[0].Count)
+}
+
+func TestInterceptorFaultInjection(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	dao.SetLogger(nil).AddInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+		if request.Operation == OperationPutItem {
+			return nil, errors.New("injected")
+		}
+		// Returning nothing at all is an error rather than a panic further on.
+		return nil, nil
+	})
+
+	_, err := dao.PutItem(&Struct3{OrgId: "org", Id: "1"})
+	assert.EqualError(t, err, "PutItem Struct3: injected")
+	_, err = dao.GetItem(&Struct3{OrgId: "org", Id: "1"})
+	assert.EqualError(t, err, "GetItem Struct3: interceptor returned neither an output nor an error")
+	_, err = dao.PagedQuery("", "{OrgId} = :o", "", map[string]interface{}{":o": "org"}, nil, 0, 10,
+		TotalSizeMode(TotalNone))
+	assert.EqualError(t, err, "Query Struct3: interceptor returned neither an output nor an error")
+}
+
+func TestInterceptTableCreation(t *testing.T) {
+	operations := make([]string, 0)
+	_, err := NewDynamoDBDaoForType(session.New(awsConfig), reflect.TypeOf(Struct3{}),
+		func(dao *DynamoDBDao) {
+			dao.SetLogger(nil)
+		},
+		WithInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+			operations = append(operations, request.Operation)
+			if request.Operation == OperationDescribeTable {
+				return nil, awserr.New(dynamodb.ErrCodeResourceNotFoundException, "not found", nil)
+			}
+			return nil, errors.New("injected")
+		}))
+	var daoErr *DaoError
+	require.True(t, errors.As(err, &daoErr))
+	assert.Equal(t, OperationCreateTable, daoErr.Operation)
+	assert.EqualError(t, daoErr.Err, "injected")
+	assert.Equal(t, []string{OperationDescribeTable, OperationCreateTable}, operations)
+}
@@ -23,12 +23,22 @@ func keySchemaForTypeWithBaseName(baseName string, structType reflect.Type) ([]*
 	for f := 0; f < structType.NumField(); f++ {
 		field := structType.Field(f)
 		name := getFieldName(baseName, field)
+		dynamoDbDaoKey, hasKeyTag := field.Tag.Lookup(keySchemaTag)
+		keyDef, template := splitKeyTemplate(strings.Split(dynamoDbDaoKey, ","))
+		if template != "" {
+			// The key is the attribute built from the template rather than the field, which need not be stored.
+			if baseName != "" {
+				return nil, nil, errors.New(structType.Name() + "." + field.Name +
+					": key templates are only allowed on top-level fields")
+			}
+			name = template[:strings.Index(template, "=")]
+		}
 		if name == "-" {
 			continue
 		}
 		var keyType string
-		if dynamoDbDaoKey, ok := field.Tag.Lookup(keySchemaTag); ok {
-			fieldKeyType, fieldThruput, err := parseDynamoKeyTag(dynamoDbDaoKey, structType, field)
+		if hasKeyTag {
+			fieldKeyType, fieldThruput, err := parseDynamoKeyTag(strings.Join(keyDef, ","), structType, field)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -0,0 +1,385 @@
+package dynamoDao
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout of the time components of key templates: UTC with a fixed number of fractional digits, so the strings
+// sort in the order of the times.
+const keyTemplateTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// A key attribute that is not a field of the struct but is built from fields of it, e.g. pk=USER#{Id}.  A template is
+// declared by adding an element of the form attribute=template to the dynamoKey or dynamoGSI tag of any top-level
+// field, usually one the template refers to:
+//
+//	type Order struct {
+//		UserId    string    `dynamoKey:"hash,pk=USER#{UserId}"`
+//		CreatedAt time.Time `dynamoKey:"range,sk=ORDER#{CreatedAt}#{OrderId}"`
+//		OrderId   string    `dynamoGSI:"ByOrder,hash,gsi1pk=ORDER#{OrderId}"`
+//	}
+//
+// The attribute then takes the field's place in the key schema and its value is written with every item in which any of
+// its fields is set; like an omitempty attribute it is left out when they are all zero, so that an index keyed on it
+// stays sparse.  The {} placeholders are Go field names of top-level string, integer or time.Time fields, and must be
+// separated by literal text so the value can be parsed back into the fields on read.  Integers are zero padded and
+// times are written in UTC with a fixed number of fractional digits so the values sort in the order of the fields.
+// Templates cannot contain ',' or ';'.
+type keyTemplate struct {
+	attrName string
+	// The literal text before, between and after the fields; there is one more literal than there are fields.
+	literals []string
+	fields   []reflect.StructField
+}
+
+// Removes the attribute=template element from the elements of a dynamoKey or dynamoGSI tag, returning the remaining
+// elements and the template, which is empty if there isn't one.
+func splitKeyTemplate(elements []string) ([]string, string) {
+	for i, element := range elements {
+		if strings.Contains(element, "=") {
+			rest := append(append([]string(nil), elements[:i]...), elements[i+1:]...)
+			return rest, element
+		}
+	}
+	return elements, ""
+}
+
+// Parses a template declaration (e.g. pk=USER#{Id}) against the struct type.
+func parseKeyTemplate(structType reflect.Type, declaration string) (*keyTemplate, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid key template %s: %s", declaration, reason)
+	}
+	equals := strings.Index(declaration, "=")
+	kt := &keyTemplate{attrName: declaration[:equals]}
+	if kt.attrName == "" {
+		return nil, invalid("missing attribute name")
+	}
+	template := declaration[equals+1:]
+	for {
+		open := strings.Index(template, "{")
+		if open < 0 {
+			break
+		}
+		close := strings.Index(template[open:], "}")
+		if close < 0 {
+			return nil, invalid("unclosed {")
+		}
+		literal := template[:open]
+		if len(kt.fields) > 0 && literal == "" {
+			return nil, invalid("fields must be separated by literal text")
+		}
+		name := template[open+1 : open+close]
+		field, found := structType.FieldByName(name)
+		if !found || field.PkgPath != "" {
+			return nil, invalid("unknown field " + name)
+		}
+		if !keyTemplateFieldType(field.Type) {
+			return nil, invalid(fmt.Sprintf("field %s has unsupported type %s", name, field.Type))
+		}
+		kt.literals = append(kt.literals, literal)
+		kt.fields = append(kt.fields, field)
+		template = template[open+close+1:]
+	}
+	if len(kt.fields) == 0 {
+		return nil, invalid("no fields")
+	}
+	kt.literals = append(kt.literals, template)
+	return kt, nil
+}
+
+func keyTemplateFieldType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return typ == reflect.TypeOf(time.Time{})
+}
+
+// Finds the key templates declared in the dynamoKey and dynamoGSI tags of the top-level fields of the struct.  An
+// attribute may be declared by more than one tag as long as the templates are the same.
+func keyTemplatesForType(structType reflect.Type) ([]*keyTemplate, error) {
+	declarations := make(map[string]string)
+	templates := make([]*keyTemplate, 0)
+	add := func(declaration string) error {
+		if declaration == "" {
+			return nil
+		}
+		kt, err := parseKeyTemplate(structType, declaration)
+		if err != nil {
+			return err
+		}
+		if existing, ok := declarations[kt.attrName]; ok {
+			if existing != declaration {
+				return fmt.Errorf("conflicting key templates %s and %s", existing, declaration)
+			}
+			return nil
+		}
+		declarations[kt.attrName] = declaration
+		templates = append(templates, kt)
+		return nil
+	}
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		if tag, ok := field.Tag.Lookup(keySchemaTag); ok {
+			_, declaration := splitKeyTemplate(strings.Split(tag, ","))
+			if err := add(declaration); err != nil {
+				return nil, err
+			}
+		}
+		if tag, ok := field.Tag.Lookup(globalIndexTag); ok {
+			for _, gsiStr := range strings.Split(tag, ";") {
+				_, declaration := splitKeyTemplate(strings.Split(gsiStr, ","))
+				if err := add(declaration); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return templates, nil
+}
+
+// Builds the value of the attribute from the struct.
+func (kt *keyTemplate) format(value reflect.Value) (string, error) {
+	formatted := new(strings.Builder)
+	for i, field := range kt.fields {
+		formatted.WriteString(kt.literals[i])
+		component := formatKeyComponent(value.FieldByIndex(field.Index))
+		if separator := kt.literals[i+1]; separator != "" && i < len(kt.fields)-1 &&
+			strings.Contains(component, separator) {
+			return "", fmt.Errorf("key template %s: %s %q contains the separator %q", kt.attrName, field.Name,
+				component, separator)
+		}
+		formatted.WriteString(component)
+	}
+	formatted.WriteString(kt.literals[len(kt.fields)])
+	return formatted.String(), nil
+}
+
+// Returns whether all the fields of the template are zero in the struct.
+func (kt *keyTemplate) empty(value reflect.Value) bool {
+	for _, field := range kt.fields {
+		if !value.FieldByIndex(field.Index).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// Builds the leading part of the attribute's value from the struct, up to the first field with a zero value.
+func (kt *keyTemplate) prefix(value reflect.Value) string {
+	prefix := new(strings.Builder)
+	for i, field := range kt.fields {
+		prefix.WriteString(kt.literals[i])
+		fieldValue := value.FieldByIndex(field.Index)
+		if fieldValue.IsZero() {
+			return prefix.String()
+		}
+		prefix.WriteString(formatKeyComponent(fieldValue))
+	}
+	prefix.WriteString(kt.literals[len(kt.fields)])
+	return prefix.String()
+}
+
+// Parses the value of the attribute back into the fields of the struct that are zero, i.e. that were not stored as
+// attributes of their own.
+func (kt *keyTemplate) parse(s string, value reflect.Value) error {
+	mismatch := fmt.Errorf("key template %s: %q does not match the template", kt.attrName, s)
+	prefix, suffix := kt.literals[0], kt.literals[len(kt.fields)]
+	if !strings.HasPrefix(s, prefix) || !strings.HasSuffix(s[len(prefix):], suffix) {
+		return mismatch
+	}
+	rest := s[len(prefix) : len(s)-len(suffix)]
+	for i, field := range kt.fields {
+		component := rest
+		if i < len(kt.fields)-1 {
+			end := strings.Index(rest, kt.literals[i+1])
+			if end < 0 {
+				return mismatch
+			}
+			component, rest = rest[:end], rest[end+len(kt.literals[i+1]):]
+		}
+		fieldValue := value.FieldByIndex(field.Index)
+		if !fieldValue.IsZero() {
+			continue
+		}
+		if err := parseKeyComponent(component, fieldValue); err != nil {
+			return fmt.Errorf("key template %s: %s: %v", kt.attrName, field.Name, err)
+		}
+	}
+	return nil
+}
+
+// Formats a field of a key template so the strings sort in the order of the values.  Non-negative integers are zero
+// padded to 19 digits; negative integers are written as '-' followed by the value offset by 2^63, zero padded, so they
+// sort before the non-negative ones and in order among themselves.  Unsigned integers are zero padded to 20 digits.
+func formatKeyComponent(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := value.Int(); n < 0 {
+			return fmt.Sprintf("-%019d", uint64(n)-1<<63)
+		}
+		return fmt.Sprintf("%019d", value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprintf("%020d", value.Uint())
+	case reflect.String:
+		return value.String()
+	}
+	return value.Interface().(time.Time).UTC().Format(keyTemplateTimeLayout)
+}
+
+func parseKeyComponent(s string, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if strings.HasPrefix(s, "-") {
+			offset, err := strconv.ParseUint(s[1:], 10, 64)
+			if err != nil {
+				return err
+			}
+			n = int64(offset + 1<<63)
+		} else {
+			var err error
+			if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return err
+			}
+		}
+		if value.OverflowInt(n) {
+			return fmt.Errorf("%s overflows %s", s, value.Type())
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if value.OverflowUint(n) {
+			return fmt.Errorf("%s overflows %s", s, value.Type())
+		}
+		value.SetUint(n)
+	case reflect.String:
+		value.SetString(s)
+	default:
+		t, err := time.Parse(keyTemplateTimeLayout, s)
+		if err != nil {
+			return err
+		}
+		value.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+// Finds the key template of the attribute in the DAO's type or, failing that, in the types registered with it.
+func (dao *DynamoDBDao) keyTemplate(attrName string) *keyTemplate {
+	keyTemplates := append([]*keyTemplate(nil), dao.keyTemplates...)
+	for _, rt := range dao.types {
+		keyTemplates = append(keyTemplates, rt.keyTemplates...)
+	}
+	for _, kt := range keyTemplates {
+		if kt.attrName == attrName {
+			return kt
+		}
+	}
+	return nil
+}
+
+// Returns the value of the item as a struct and the key templates of its type, false if it is neither the DAO's type
+// nor one registered with it (see RegisterType).
+func (dao *DynamoDBDao) structValue(item interface{}) (reflect.Value, []*keyTemplate, bool) {
+	value := reflect.ValueOf(item)
+	for value.Kind() == reflect.Ptr && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return value, nil, false
+	}
+	if value.Type() == dao.structType {
+		return value, dao.keyTemplates, true
+	}
+	if rt := dao.registeredType(value.Type()); rt != nil {
+		return value, rt.keyTemplates, true
+	}
+	return value, nil, false
+}
+
+// Adds the attributes built from the key templates to the attributes of the item, except those of templates whose
+// fields are all zero.
+func (dao *DynamoDBDao) fillKeyTemplates(item interface{}, attrVals map[string]*dynamodb.AttributeValue) error {
+	value, keyTemplates, _ := dao.structValue(item)
+	for _, kt := range keyTemplates {
+		if kt.empty(value) {
+			continue
+		}
+		s, err := kt.format(value)
+		if err != nil {
+			return err
+		}
+		attrVals[kt.attrName] = new(dynamodb.AttributeValue).SetS(s)
+	}
+	return nil
+}
+
+// Parses the attributes built from the key templates back into the fields of the item.
+func (dao *DynamoDBDao) parseKeyTemplates(attrVals map[string]*dynamodb.AttributeValue, item interface{}) error {
+	value, keyTemplates, _ := dao.structValue(item)
+	for _, kt := range keyTemplates {
+		if attrVal, ok := attrVals[kt.attrName]; ok && attrVal.S != nil {
+			if err := kt.parse(*attrVal.S, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Finds the key template of the attribute in the type of the item.
+func (dao *DynamoDBDao) itemKeyTemplate(attrName string, item interface{}) (*keyTemplate, reflect.Value, error) {
+	item, err := dao.withTenant(item)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+	value, keyTemplates, ok := dao.structValue(item)
+	if !ok {
+		return nil, value, fmt.Errorf("key template %s: item must be a %s or a registered type", attrName,
+			dao.structType)
+	}
+	for _, kt := range keyTemplates {
+		if kt.attrName == attrName {
+			return kt, value, nil
+		}
+	}
+	return nil, value, fmt.Errorf("no key template for attribute %s in %s", attrName, value.Type())
+}
+
+// Returns the value of the key attribute declared by a key template (e.g. pk=USER#{Id}) for the item, e.g. USER#42, for
+// use in query key conditions:
+//
+//	pk, err := dao.KeyValue("pk", &User{Id: "42"})
+//	page, err := dao.Query().Key("pk").Eq(pk).Execute()
+//
+// The item may be of the DAO's type or of any type registered with it (see RegisterType).  A DAO scoped to a tenant
+// (see ForTenant) sets the tenant field of the item first, but does not prefix the value with the tenant ID, which
+// its queries do.
+func (dao *DynamoDBDao) KeyValue(attrName string, item interface{}) (string, error) {
+	kt, value, err := dao.itemKeyTemplate(attrName, item)
+	if err != nil {
+		return "", err
+	}
+	return kt.format(value)
+}
+
+// Returns the leading part of the value of the key attribute declared by a key template for the item, up to the first
+// field with a zero value, for use in begins_with range key conditions.  For the template
+// sk=ORDER#{CreatedAt}#{OrderId} and an item with only CreatedAt set it returns ORDER#<CreatedAt>#, which matches every
+// order created at that time.
+func (dao *DynamoDBDao) KeyPrefix(attrName string, item interface{}) (string, error) {
+	kt, value, err := dao.itemKeyTemplate(attrName, item)
+	if err != nil {
+		return "", err
+	}
+	return kt.prefix(value), nil
+}
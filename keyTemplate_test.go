@@ -0,0 +1,155 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type TemplatedOrder struct {
+	UserId    string    `dynamodbav:"-" dynamoKey:"hash,pk=USER#{UserId}"`
+	CreatedAt time.Time `dynamodbav:"created_at" dynamoKey:"range,sk=ORDER#{CreatedAt}#{OrderId}"`
+	OrderId   string    `dynamodbav:"order_id" dynamoGSI:"ByOrder,hash,gsi1pk=ORDER#{OrderId}"`
+	Sequence  int64     `dynamodbav:"-" dynamoGSI:"ByOrder,range,gsi1sk=SEQ#{Sequence}"`
+	Total     int       `dynamodbav:"total"`
+}
+
+func TestKeyTemplateSchema(t *testing.T) {
+	dao := newTestDao(t, "TemplatedOrder", reflect.TypeOf(TemplatedOrder{}))
+	table := dao.tableDescription
+	require.Equal(t, 2, len(table.KeySchema))
+	assert.Equal(t, "pk", *table.KeySchema[0].AttributeName)
+	assert.Equal(t, "sk", *table.KeySchema[1].AttributeName)
+	assert.Equal(t, []string{"pk", "sk"}, dao.keyAttrNames)
+	require.Equal(t, 1, len(table.GlobalSecondaryIndexes))
+	gsi := table.GlobalSecondaryIndexes[0]
+	assert.Equal(t, "gsi1pk", *gsi.KeySchema[0].AttributeName)
+	assert.Equal(t, dynamodb.KeyTypeHash, *gsi.KeySchema[0].KeyType)
+	assert.Equal(t, "gsi1sk", *gsi.KeySchema[1].AttributeName)
+
+	attrTypes := make(map[string]string)
+	for _, attrDef := range table.AttributeDefinitions {
+		attrTypes[*attrDef.AttributeName] = *attrDef.AttributeType
+	}
+	assert.Equal(t, map[string]string{"pk": "S", "sk": "S", "gsi1pk": "S", "gsi1sk": "S"}, attrTypes)
+}
+
+func TestKeyTemplateMarshal(t *testing.T) {
+	dao := newTestDao(t, "TemplatedOrder", reflect.TypeOf(TemplatedOrder{}))
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	order := &TemplatedOrder{UserId: "joe", CreatedAt: createdAt, OrderId: "o-1", Sequence: -3, Total: 10}
+
+	attrVals, err := dao.MarshalAttributes(order)
+	require.NoError(t, err)
+	assert.Equal(t, "USER#joe", *attrVals["pk"].S)
+	assert.Equal(t, "ORDER#2024-03-01T17:30:00.000000000Z#o-1", *attrVals["sk"].S)
+	assert.Equal(t, "ORDER#o-1", *attrVals["gsi1pk"].S)
+	assert.Equal(t, "SEQ#-9223372036854775805", *attrVals["gsi1sk"].S)
+
+	keyAttrs, err := dao.MarshalKey(order)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(keyAttrs))
+	assert.Equal(t, "USER#joe", *keyAttrs["pk"].S)
+
+	// The fields that are only stored in the key attributes are parsed back out of them.
+	loaded, err := dao.UnmarshalAttributes(attrVals)
+	require.NoError(t, err)
+	assert.Equal(t, "joe", loaded.(*TemplatedOrder).UserId)
+	assert.Equal(t, int64(-3), loaded.(*TemplatedOrder).Sequence)
+	assert.True(t, createdAt.Equal(loaded.(*TemplatedOrder).CreatedAt))
+
+	attrVals["pk"].SetS("ACCOUNT#joe")
+	_, err = dao.UnmarshalAttributes(attrVals)
+	assert.EqualError(t, err, "key template pk: \"ACCOUNT#joe\" does not match the template")
+
+	// Only the last field may contain the separator that follows it.
+	order.OrderId = "o#1"
+	_, err = dao.MarshalAttributes(order)
+	require.NoError(t, err)
+	kt, err := parseKeyTemplate(reflect.TypeOf(TemplatedOrder{}), "x={OrderId}#{UserId}")
+	require.NoError(t, err)
+	_, err = kt.format(reflect.ValueOf(*order))
+	assert.EqualError(t, err, "key template x: OrderId \"o#1\" contains the separator \"#\"")
+}
+
+func TestKeyTemplateSparse(t *testing.T) {
+	dao := newTestDao(t, "TemplatedOrder", reflect.TypeOf(TemplatedOrder{}))
+	createdAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Items without an order ID or sequence are left out of the ByOrder index.
+	attrVals, err := dao.MarshalAttributes(&TemplatedOrder{UserId: "joe", CreatedAt: createdAt, Total: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "USER#joe", *attrVals["pk"].S)
+	assert.Equal(t, "ORDER#2024-03-01T00:00:00.000000000Z#", *attrVals["sk"].S)
+	assert.NotContains(t, attrVals, "gsi1pk")
+	assert.NotContains(t, attrVals, "gsi1sk")
+	loaded, err := dao.UnmarshalAttributes(attrVals)
+	require.NoError(t, err)
+	assert.Equal(t, "", loaded.(*TemplatedOrder).OrderId)
+	assert.Equal(t, int64(0), loaded.(*TemplatedOrder).Sequence)
+}
+
+func TestKeyTemplateSortOrder(t *testing.T) {
+	values := []interface{}{int64(-1 << 63), int64(-100), int64(-1), int64(0), int64(7), int64(100), int64(1<<63 - 1)}
+	formatted := make([]string, 0, len(values))
+	for _, v := range values {
+		s := formatKeyComponent(reflect.ValueOf(v))
+		formatted = append(formatted, s)
+		parsed := reflect.New(reflect.TypeOf(v)).Elem()
+		require.NoError(t, parseKeyComponent(s, parsed))
+		assert.Equal(t, v, parsed.Interface())
+	}
+	assert.True(t, sort.StringsAreSorted(formatted), "%v", formatted)
+
+	early := formatKeyComponent(reflect.ValueOf(time.Date(2024, 1, 1, 0, 0, 0, 5, time.UTC)))
+	late := formatKeyComponent(reflect.ValueOf(time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC)))
+	assert.True(t, early < late)
+	assert.Equal(t, "00000000000000000042", formatKeyComponent(reflect.ValueOf(uint8(42))))
+	assert.EqualError(t, parseKeyComponent("300", reflect.New(reflect.TypeOf(int8(0))).Elem()), "300 overflows int8")
+}
+
+func TestKeyTemplateQueries(t *testing.T) {
+	dao := newTestDao(t, "TemplatedOrder", reflect.TypeOf(TemplatedOrder{}))
+	pk, err := dao.KeyValue("pk", &TemplatedOrder{UserId: "joe"})
+	require.NoError(t, err)
+	assert.Equal(t, "USER#joe", pk)
+	prefix, err := dao.KeyPrefix("sk", TemplatedOrder{})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER#", prefix)
+	_, err = dao.KeyValue("total", &TemplatedOrder{})
+	assert.EqualError(t, err, "no key template for attribute total in dynamoDao.TemplatedOrder")
+
+	_, keyExpression, _, queryValues, err := dao.Query().Key("pk").Eq(pk).Range("sk").BeginsWith(prefix).Build()
+	require.NoError(t, err)
+	assert.Equal(t, "{pk} = :v0 and begins_with({sk}, :v1)", keyExpression)
+	assert.Equal(t, map[string]interface{}{":v0": "USER#joe", ":v1": "ORDER#"}, queryValues)
+
+	conditions, err := dao.exampleConditions(&TemplatedOrder{OrderId: "o-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER#o-1", conditions["gsi1pk"])
+	assert.NotContains(t, conditions, "pk")
+	candidate := dao.bestIndexFor(conditions)
+	require.NotNil(t, candidate)
+	assert.Equal(t, "ByOrder", candidate.indexName)
+}
+
+func TestKeyTemplateErrors(t *testing.T) {
+	typ := reflect.TypeOf(TemplatedOrder{})
+	for declaration, message := range map[string]string{
+		"=USER#{UserId}":         "invalid key template =USER#{UserId}: missing attribute name",
+		"pk=USER":                "invalid key template pk=USER: no fields",
+		"pk=USER#{UserId":        "invalid key template pk=USER#{UserId: unclosed {",
+		"pk={UserId}{OrderId}":   "invalid key template pk={UserId}{OrderId}: fields must be separated by literal text",
+		"pk=USER#{Name}":         "invalid key template pk=USER#{Name}: unknown field Name",
+		"pk=USER#{UserId}#{Foo}": "invalid key template pk=USER#{UserId}#{Foo}: unknown field Foo",
+	} {
+		_, err := parseKeyTemplate(typ, declaration)
+		assert.EqualError(t, err, message)
+	}
+	_, err := parseKeyTemplate(reflect.TypeOf(TestStruct{}), "pk=X#{C}")
+	assert.EqualError(t, err, "invalid key template pk=X#{C}: field C has unsupported type float32")
+}
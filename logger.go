@@ -0,0 +1,255 @@
+package dynamoDao
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LogLevel is the severity of a message logged by the DAO.
+type LogLevel int32
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+	// LogOff is above every level, a StdLogger at this level logs nothing.
+	LogOff
+)
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	case LogOff:
+		return "OFF"
+	}
+	return "LEVEL(" + strconv.Itoa(int(level)) + ")"
+}
+
+// LogField is a named value attached to a logged message, e.g. the table, operation, index or duration of a request.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the messages logged by a DAO (see SetLogger).  Every message has at least the table field.
+type Logger interface {
+	Log(level LogLevel, message string, fields ...LogField)
+}
+
+// StdLogger is a Logger writing a line per message to a standard library logger, e.g.
+//
+//	ERROR request failed table=Person op=GetItem duration=1.2ms error="ResourceNotFoundException: ..."
+type StdLogger struct {
+	logger *log.Logger
+	level  int32
+}
+
+// Creates a logger writing the messages at the level or above to the logger, or to the standard logger if it is nil.
+func NewStdLogger(logger *log.Logger, level LogLevel) *StdLogger {
+	return &StdLogger{logger: logger, level: int32(level)}
+}
+
+// Changes the lowest level logged.  It is safe to call while the logger is in use.
+func (l *StdLogger) SetLevel(level LogLevel) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+func (l *StdLogger) Log(level LogLevel, message string, fields ...LogField) {
+	if int32(level) < atomic.LoadInt32(&l.level) {
+		return
+	}
+	line := new(strings.Builder)
+	line.WriteString(level.String())
+	line.WriteString(" ")
+	line.WriteString(message)
+	for _, field := range fields {
+		value := fmt.Sprint(field.Value)
+		if err, ok := field.Value.(error); ok {
+			value = err.Error()
+		}
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(line, " %s=%s", field.Key, value)
+	}
+	if l.logger != nil {
+		l.logger.Print(line.String())
+	} else {
+		log.Print(line.String())
+	}
+}
+
+// Sets the logger the DAO's messages are written to, nil disables logging.  By default errors are written to the
+// standard logger.
+func (dao *DynamoDBDao) SetLogger(logger Logger) *DynamoDBDao {
+	dao.logger = logger
+	return dao
+}
+
+// Turns the logging of every request sent to DynamoDB, at the info level, on or off.  It is safe to call while the DAO
+// is in use.
+func (dao *DynamoDBDao) SetLogRequests(logRequests bool) *DynamoDBDao {
+	value := int32(0)
+	if logRequests {
+		value = 1
+	}
+	atomic.StoreInt32(&dao.logRequests, value)
+	return dao
+}
+
+// Sets whether the values of the attributes of items, keys and expressions are replaced by their types when requests
+// are logged, which they are by default so that logs do not hold the contents of the table.
+func (dao *DynamoDBDao) SetLogRedaction(redact bool) *DynamoDBDao {
+	dao.logUnredacted = !redact
+	return dao
+}
+
+func (dao *DynamoDBDao) log(level LogLevel, message string, fields ...LogField) {
+	if dao.logger == nil {
+		return
+	}
+	dao.logger.Log(level, message, append([]LogField{{Key: "table", Value: dao.TableName}}, fields...)...)
+}
+
+// Logs the request if it failed or requests are being logged.  Failed conditions are logged at the debug level, other
+// failures as errors.
+func (dao *DynamoDBDao) logRequest(operation, indexName string, input interface{}, duration time.Duration,
+	err error) {
+	logRequests := atomic.LoadInt32(&dao.logRequests) != 0
+	if err == nil && !logRequests {
+		return
+	}
+	fields := []LogField{{Key: "op", Value: operation}}
+	if indexName != "" {
+		fields = append(fields, LogField{Key: "index", Value: indexName})
+	}
+	fields = append(fields, LogField{Key: "duration", Value: duration})
+	if err != nil {
+		fields = append(fields, LogField{Key: "error", Value: err})
+	}
+	if logRequests {
+		fields = append(fields, dao.requestFields(input)...)
+	}
+	awsErr, _ := err.(awserr.Error)
+	if awsErr != nil && operation == OperationDescribeTable &&
+		awsErr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		// Expected while the table is being created.
+		dao.log(LogDebug, "table not found", fields...)
+	} else if awsErr != nil && awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// Returned to the caller as ErrConditionFailed, which is how conditional writes report that the item is not
+		// in the state they require, e.g. that it was already deleted.
+		dao.log(LogDebug, "condition failed", fields...)
+	} else if err != nil {
+		dao.log(LogError, "request failed", fields...)
+	} else {
+		dao.log(LogInfo, "request", fields...)
+	}
+}
+
+// Returns the expressions, key, item and values of the request, with the attribute values redacted unless the DAO is
+// set not to.
+func (dao *DynamoDBDao) requestFields(input interface{}) []LogField {
+	fields := make([]LogField, 0)
+	expression := func(key string, value *string) {
+		if value != nil {
+			fields = append(fields, LogField{Key: key, Value: *value})
+		}
+	}
+	attributes := func(key string, value map[string]*dynamodb.AttributeValue) {
+		if len(value) > 0 {
+			fields = append(fields, LogField{Key: key, Value: dao.loggedAttributes(value)})
+		}
+	}
+	switch input := input.(type) {
+	case *dynamodb.PutItemInput:
+		attributes("item", input.Item)
+		expression("condition", input.ConditionExpression)
+	case *dynamodb.GetItemInput:
+		attributes("key", input.Key)
+		expression("projection", input.ProjectionExpression)
+	case *dynamodb.UpdateItemInput:
+		attributes("key", input.Key)
+		expression("update", input.UpdateExpression)
+		expression("condition", input.ConditionExpression)
+	case *dynamodb.DeleteItemInput:
+		attributes("key", input.Key)
+		expression("condition", input.ConditionExpression)
+	case *dynamodb.QueryInput:
+		expression("keyCondition", input.KeyConditionExpression)
+		expression("filter", input.FilterExpression)
+		expression("projection", input.ProjectionExpression)
+		expression("select", input.Select)
+		attributes("values", input.ExpressionAttributeValues)
+		attributes("startKey", input.ExclusiveStartKey)
+	case *dynamodb.ScanInput:
+		expression("filter", input.FilterExpression)
+		expression("projection", input.ProjectionExpression)
+		expression("select", input.Select)
+		attributes("values", input.ExpressionAttributeValues)
+		attributes("startKey", input.ExclusiveStartKey)
+	}
+	return fields
+}
+
+// Formats the attributes as {name:value, ...} sorted by name, where the value is replaced by its type, e.g. S, when
+// redacted.
+func (dao *DynamoDBDao) loggedAttributes(attrs map[string]*dynamodb.AttributeValue) string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		if dao.logUnredacted {
+			formatted[i] = name + ":" + strings.Join(strings.Fields(attrs[name].String()), " ")
+		} else {
+			formatted[i] = name + ":" + attributeValueType(attrs[name])
+		}
+	}
+	return "{" + strings.Join(formatted, ", ") + "}"
+}
+
+func attributeValueType(value *dynamodb.AttributeValue) string {
+	switch {
+	case value == nil:
+		return "nil"
+	case value.S != nil:
+		return "S"
+	case value.N != nil:
+		return "N"
+	case value.B != nil:
+		return "B"
+	case value.BOOL != nil:
+		return "BOOL"
+	case aws.BoolValue(value.NULL):
+		return "NULL"
+	case value.M != nil:
+		return "M"
+	case value.L != nil:
+		return "L"
+	case value.SS != nil:
+		return "SS"
+	case value.NS != nil:
+		return "NS"
+	case value.BS != nil:
+		return "BS"
+	}
+	return "?"
+}
@@ -0,0 +1,114 @@
+package dynamoDao
+
+import (
+	"bytes"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type logEntry struct {
+	level   LogLevel
+	message string
+	fields  map[string]interface{}
+}
+
+type memoryLogger struct {
+	entries []logEntry
+}
+
+func (l *memoryLogger) Log(level LogLevel, message string, fields ...LogField) {
+	entry := logEntry{level: level, message: message, fields: make(map[string]interface{})}
+	for _, field := range fields {
+		entry.fields[field.Key] = field.Value
+	}
+	l.entries = append(l.entries, entry)
+}
+
+func TestStdLogger(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := NewStdLogger(log.New(buffer, "", 0), LogInfo)
+	logger.Log(LogDebug, "hidden")
+	logger.Log(LogError, "request failed", LogField{Key: "table", Value: "Person"},
+		LogField{Key: "duration", Value: 1500 * time.Microsecond}, LogField{Key: "error", Value: errors.New("it broke")})
+	assert.Equal(t, "ERROR request failed table=Person duration=1.5ms error=\"it broke\"\n", buffer.String())
+
+	buffer.Reset()
+	logger.SetLevel(LogOff)
+	logger.Log(LogError, "hidden")
+	logger.SetLevel(LogDebug)
+	logger.Log(LogDebug, "shown", LogField{Key: "empty", Value: ""})
+	assert.Equal(t, "DEBUG shown empty=\"\"\n", buffer.String())
+	assert.Equal(t, "LEVEL(9)", LogLevel(9).String())
+}
+
+func TestLogRequests(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	logger := new(memoryLogger)
+	dao.SetLogger(logger)
+	getItem := new(dynamodb.GetItemInput).SetKey(map[string]*dynamodb.AttributeValue{
+		"organization_id": new(dynamodb.AttributeValue).SetS("org"),
+		"person_id":       new(dynamodb.AttributeValue).SetS("joe@example.com"),
+	})
+	succeed := func(...request.Option) (interface{}, error) {
+		return new(dynamodb.GetItemOutput), nil
+	}
+
+	_, err := dao.send(OperationGetItem, "", getItem, succeed)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(logger.entries))
+
+	_, err = dao.send(OperationGetItem, "", getItem, func(...request.Option) (interface{}, error) {
+		return (*dynamodb.GetItemOutput)(nil), errors.New("boom")
+	})
+	assert.EqualError(t, err, "GetItem Struct3: boom")
+	require.Equal(t, 1, len(logger.entries))
+	assert.Equal(t, LogError, logger.entries[0].level)
+	assert.Equal(t, "request failed", logger.entries[0].message)
+	assert.Equal(t, "Struct3", logger.entries[0].fields["table"])
+	assert.Equal(t, OperationGetItem, logger.entries[0].fields["op"])
+	assert.EqualError(t, logger.entries[0].fields["error"].(error), "boom")
+	assert.NotContains(t, logger.entries[0].fields, "key")
+
+	// Failed conditions are left to the caller.
+	updateItem := new(dynamodb.UpdateItemInput)
+	_, err = dao.send(OperationUpdateItem, "", updateItem, func(...request.Option) (interface{}, error) {
+		return (*dynamodb.UpdateItemOutput)(nil),
+			awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "condition failed", nil)
+	})
+	assert.True(t, errors.Is(err, ErrConditionFailed))
+	require.Equal(t, 2, len(logger.entries))
+	assert.Equal(t, LogDebug, logger.entries[1].level)
+	assert.Equal(t, "condition failed", logger.entries[1].message)
+	logger.entries = logger.entries[:1]
+
+	dao.SetLogRequests(true)
+	_, err = dao.send(OperationGetItem, "", getItem, succeed)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(logger.entries))
+	assert.Equal(t, LogInfo, logger.entries[1].level)
+	assert.Equal(t, "{organization_id:S, person_id:S}", logger.entries[1].fields["key"])
+
+	dao.SetLogRedaction(false)
+	_, err = dao.send(OperationGetItem, "", getItem, succeed)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(logger.entries))
+	assert.Contains(t, logger.entries[2].fields["key"], "joe@example.com")
+
+	dao.SetLogRequests(false)
+	_, err = dao.send(OperationGetItem, "", getItem, succeed)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(logger.entries))
+
+	// A nil logger disables logging.
+	dao.SetLogger(nil).SetLogRequests(true)
+	_, err = dao.send(OperationGetItem, "", getItem, succeed)
+	require.NoError(t, err)
+}
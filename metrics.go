@@ -0,0 +1,282 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"sync"
+	"time"
+)
+
+// The operations reported to a MetricsCollector.  The COUNT queries and scans run by PagedQuery and PagedScan to
+// compute their totals are reported separately from the queries and scans reading their pages.
+const (
+	OperationPutItem    = "PutItem"
+	OperationGetItem    = "GetItem"
+	OperationUpdateItem = "UpdateItem"
+	OperationDeleteItem = "DeleteItem"
+	OperationQuery      = "Query"
+	OperationScan       = "Scan"
+	OperationCountQuery = "CountQuery"
+	OperationCountScan  = "CountScan"
+)
+
+// OperationMetrics describes a single request to DynamoDB, one page for queries and scans.  The capacity units are
+// those DynamoDB reports consuming; IndexCapacityUnits holds those of each secondary index involved.  Count is the
+// number of items returned (for GetItem zero or one) and ScannedCount the number of items read before the filter was
+// applied, both are zero for writes.  Latency includes the time spent retrying, and Retries is the number of attempts
+// after the first (see SetRetryPolicy).  Err is the error of the last attempt.
+type OperationMetrics struct {
+	Table              string
+	Index              string
+	Operation          string
+	Latency            time.Duration
+	CapacityUnits      float64
+	TableCapacityUnits float64
+	IndexCapacityUnits map[string]float64
+	Count              int64
+	ScannedCount       int64
+	Retries            int
+	Err                error
+}
+
+// MetricsCollector receives the metrics of every request the DAO sends to DynamoDB (see SetMetricsCollector).  It is
+// called synchronously, from whichever goroutine is using the DAO.
+type MetricsCollector interface {
+	RecordOperation(metrics OperationMetrics)
+}
+
+// Sets the collector the metrics of every request are reported to, nil (the default) disables reporting.  Every request
+// asks DynamoDB to return the capacity consumed by the table and each index whether or not metrics are reported.
+func (dao *DynamoDBDao) SetMetricsCollector(metrics MetricsCollector) *DynamoDBDao {
+	dao.metrics = metrics
+	return dao
+}
+
+// Sends a request to DynamoDB with the call, which must return the output of the request, through the interceptors,
+// retrying it according to the retry policy, and logs and reports its metrics.  Every attempt goes through the
+// interceptors.  The call must send the request with the options it is given, which turn the SDK's retries off when the
+// DAO has a retry policy.  An error is returned as a *DaoError.
+func (dao *DynamoDBDao) send(operation, indexName string, input interface{},
+	call func(opts ...request.Option) (interface{}, error)) (interface{}, error) {
+	setReturnConsumedCapacity(input)
+	var opts []request.Option
+	if dao.retryPolicy != nil {
+		opts = append(opts, withoutSDKRetries)
+	}
+	start := time.Now()
+	attempt := func() (interface{}, error) {
+		return dao.intercept(&Request{Table: dao.TableName, Index: indexName, Operation: operation, Input: input},
+			func() (interface{}, error) {
+				return call(opts...)
+			})
+	}
+	var output interface{}
+	var err error
+	retries := 0
+	if dao.retryPolicy != nil {
+		output, retries, err = dao.retryPolicy.do(attempt, func(attempt int, delay time.Duration, err error) {
+			dao.log(LogWarn, "retrying request", LogField{Key: "op", Value: operation},
+				LogField{Key: "index", Value: indexName}, LogField{Key: "attempt", Value: attempt},
+				LogField{Key: "delay", Value: delay}, LogField{Key: "error", Value: err})
+		})
+	} else {
+		output, err = attempt()
+	}
+	latency := time.Since(start)
+	dao.logRequest(operation, indexName, input, latency, err)
+	err = dao.wrapError(operation, indexName, err)
+	if dao.metrics != nil {
+		metrics := OperationMetrics{
+			Table:     dao.TableName,
+			Index:     indexName,
+			Operation: operation,
+			Latency:   latency,
+			Retries:   retries,
+			Err:       err,
+		}
+		if err == nil {
+			metrics.setOutput(output)
+		}
+		dao.metrics.RecordOperation(metrics)
+	}
+	return output, err
+}
+
+func setReturnConsumedCapacity(input interface{}) {
+	switch input := input.(type) {
+	case *dynamodb.PutItemInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	case *dynamodb.GetItemInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	case *dynamodb.UpdateItemInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	case *dynamodb.DeleteItemInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	case *dynamodb.QueryInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	case *dynamodb.ScanInput:
+		input.SetReturnConsumedCapacity(dynamodb.ReturnConsumedCapacityIndexes)
+	}
+}
+
+func (metrics *OperationMetrics) setOutput(output interface{}) {
+	var consumed *dynamodb.ConsumedCapacity
+	switch output := output.(type) {
+	case *dynamodb.PutItemOutput:
+		consumed = output.ConsumedCapacity
+	case *dynamodb.GetItemOutput:
+		consumed = output.ConsumedCapacity
+		if len(output.Item) > 0 {
+			metrics.Count, metrics.ScannedCount = 1, 1
+		}
+	case *dynamodb.UpdateItemOutput:
+		consumed = output.ConsumedCapacity
+	case *dynamodb.DeleteItemOutput:
+		consumed = output.ConsumedCapacity
+	case *dynamodb.QueryOutput:
+		consumed = output.ConsumedCapacity
+		metrics.Count, metrics.ScannedCount = aws.Int64Value(output.Count), aws.Int64Value(output.ScannedCount)
+	case *dynamodb.ScanOutput:
+		consumed = output.ConsumedCapacity
+		metrics.Count, metrics.ScannedCount = aws.Int64Value(output.Count), aws.Int64Value(output.ScannedCount)
+	}
+	if consumed == nil {
+		return
+	}
+	metrics.CapacityUnits = aws.Float64Value(consumed.CapacityUnits)
+	if consumed.Table != nil {
+		metrics.TableCapacityUnits = aws.Float64Value(consumed.Table.CapacityUnits)
+	}
+	for _, indexes := range []map[string]*dynamodb.Capacity{consumed.GlobalSecondaryIndexes,
+		consumed.LocalSecondaryIndexes} {
+		for indexName, capacity := range indexes {
+			if metrics.IndexCapacityUnits == nil {
+				metrics.IndexCapacityUnits = make(map[string]float64)
+			}
+			metrics.IndexCapacityUnits[indexName] = aws.Float64Value(capacity.CapacityUnits)
+		}
+	}
+}
+
+// Queries a page at a time, passing each to fn until it returns false or the last page has been read.
+func (dao *DynamoDBDao) queryPages(operation string, query *dynamodb.QueryInput,
+	fn func(*dynamodb.QueryOutput, bool) bool) error {
+	scoped, err := dao.scopeQuery(query)
+	if err != nil {
+		return dao.wrapError(operation, aws.StringValue(query.IndexName), err)
+	}
+	query = scoped
+	for {
+		output, err := dao.send(operation, aws.StringValue(query.IndexName), query,
+			func(reqOpts ...request.Option) (interface{}, error) {
+				return dao.Client.QueryWithContext(aws.BackgroundContext(), query, reqOpts...)
+			})
+		if err != nil {
+			return err
+		}
+		result := output.(*dynamodb.QueryOutput)
+		lastPage := len(result.LastEvaluatedKey) == 0
+		if !fn(result, lastPage) || lastPage {
+			return nil
+		}
+		next := *query
+		query = next.SetExclusiveStartKey(result.LastEvaluatedKey)
+	}
+}
+
+// Scans a page at a time, passing each to fn until it returns false or the last page has been read.
+func (dao *DynamoDBDao) scanPages(operation string, scan *dynamodb.ScanInput,
+	fn func(*dynamodb.ScanOutput, bool) bool) error {
+	if dao.tenant != nil {
+		return dao.wrapError(operation, aws.StringValue(scan.IndexName),
+			dao.tenant.crossTenant("scans are not allowed on a DAO scoped to tenant %s", dao.tenant.tenantID))
+	}
+	for {
+		output, err := dao.send(operation, aws.StringValue(scan.IndexName), scan,
+			func(reqOpts ...request.Option) (interface{}, error) {
+				return dao.Client.ScanWithContext(aws.BackgroundContext(), scan, reqOpts...)
+			})
+		if err != nil {
+			return err
+		}
+		result := output.(*dynamodb.ScanOutput)
+		lastPage := len(result.LastEvaluatedKey) == 0
+		if !fn(result, lastPage) || lastPage {
+			return nil
+		}
+		next := *scan
+		scan = next.SetExclusiveStartKey(result.LastEvaluatedKey)
+	}
+}
+
+// MetricsKey identifies the operations summarized by a MemoryMetricsCollector.
+type MetricsKey struct {
+	Table     string
+	Index     string
+	Operation string
+}
+
+// MetricsSummary totals the metrics of the operations with the same MetricsKey.
+type MetricsSummary struct {
+	Calls         int64
+	Errors        int64
+	CapacityUnits float64
+	Latency       time.Duration
+	Count         int64
+	ScannedCount  int64
+	Retries       int64
+}
+
+// MemoryMetricsCollector is a MetricsCollector that keeps the metrics of every operation in memory, e.g. for tests to
+// assert against.
+type MemoryMetricsCollector struct {
+	sync.Mutex
+	operations []OperationMetrics
+}
+
+func NewMemoryMetricsCollector() *MemoryMetricsCollector {
+	return &MemoryMetricsCollector{operations: make([]OperationMetrics, 0)}
+}
+
+func (collector *MemoryMetricsCollector) RecordOperation(metrics OperationMetrics) {
+	collector.Lock()
+	defer collector.Unlock()
+	collector.operations = append(collector.operations, metrics)
+}
+
+// Returns the metrics of the operations recorded, in the order they were recorded.
+func (collector *MemoryMetricsCollector) Operations() []OperationMetrics {
+	collector.Lock()
+	defer collector.Unlock()
+	return append([]OperationMetrics(nil), collector.operations...)
+}
+
+// Returns the totals of the operations recorded for each table, index and operation.
+func (collector *MemoryMetricsCollector) Summary() map[MetricsKey]MetricsSummary {
+	collector.Lock()
+	defer collector.Unlock()
+	summary := make(map[MetricsKey]MetricsSummary)
+	for _, metrics := range collector.operations {
+		key := MetricsKey{Table: metrics.Table, Index: metrics.Index, Operation: metrics.Operation}
+		totals := summary[key]
+		totals.Calls++
+		if metrics.Err != nil {
+			totals.Errors++
+		}
+		totals.CapacityUnits += metrics.CapacityUnits
+		totals.Latency += metrics.Latency
+		totals.Count += metrics.Count
+		totals.ScannedCount += metrics.ScannedCount
+		totals.Retries += int64(metrics.Retries)
+		summary[key] = totals
+	}
+	return summary
+}
+
+// Forgets the operations recorded so far.
+func (collector *MemoryMetricsCollector) Reset() {
+	collector.Lock()
+	defer collector.Unlock()
+	collector.operations = collector.operations[:0]
+}
@@ -0,0 +1,98 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSendRecordsMetrics(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	collector := NewMemoryMetricsCollector()
+	dao.SetMetricsCollector(collector)
+
+	query := new(dynamodb.QueryInput).SetTableName("Struct3").SetIndexName("Email")
+	output, err := dao.send(OperationQuery, "Email", query, func(...request.Option) (interface{}, error) {
+		assert.Equal(t, dynamodb.ReturnConsumedCapacityIndexes, aws.StringValue(query.ReturnConsumedCapacity))
+		time.Sleep(time.Millisecond)
+		return new(dynamodb.QueryOutput).SetCount(2).SetScannedCount(5).SetConsumedCapacity(
+			new(dynamodb.ConsumedCapacity).SetCapacityUnits(1.5).
+				SetTable(new(dynamodb.Capacity).SetCapacityUnits(0.5)).
+				SetGlobalSecondaryIndexes(map[string]*dynamodb.Capacity{
+					"Email": new(dynamodb.Capacity).SetCapacityUnits(1),
+				})), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *output.(*dynamodb.QueryOutput).Count)
+
+	getItem := new(dynamodb.GetItemInput)
+	_, err = dao.send(OperationGetItem, "", getItem, func(...request.Option) (interface{}, error) {
+		return (*dynamodb.GetItemOutput)(nil), errors.New("boom")
+	})
+	assert.EqualError(t, err, "GetItem Struct3: boom")
+	assert.Equal(t, dynamodb.ReturnConsumedCapacityIndexes, aws.StringValue(getItem.ReturnConsumedCapacity))
+
+	operations := collector.Operations()
+	require.Equal(t, 2, len(operations))
+	assert.True(t, operations[0].Latency >= time.Millisecond)
+	operations[0].Latency = 0
+	assert.Equal(t, OperationMetrics{
+		Table:              "Struct3",
+		Index:              "Email",
+		Operation:          OperationQuery,
+		CapacityUnits:      1.5,
+		TableCapacityUnits: 0.5,
+		IndexCapacityUnits: map[string]float64{"Email": 1},
+		Count:              2,
+		ScannedCount:       5,
+	}, operations[0])
+	assert.Equal(t, OperationGetItem, operations[1].Operation)
+	assert.EqualError(t, operations[1].Err, "GetItem Struct3: boom")
+
+	summary := collector.Summary()
+	queryTotals := summary[MetricsKey{Table: "Struct3", Index: "Email", Operation: OperationQuery}]
+	assert.Equal(t, int64(1), queryTotals.Calls)
+	assert.Equal(t, 1.5, queryTotals.CapacityUnits)
+	assert.Equal(t, int64(5), queryTotals.ScannedCount)
+	assert.Equal(t, int64(1), summary[MetricsKey{Table: "Struct3", Operation: OperationGetItem}].Errors)
+
+	collector.Reset()
+	assert.Equal(t, 0, len(collector.Operations()))
+}
+
+func TestDynamoDBDao_Metrics(t *testing.T) {
+	sess := session.New(awsConfig)
+	client := dynamodb.New(sess)
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("CachedStruct")})
+	if err == nil {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("CachedStruct")})
+		require.NoError(t, err)
+	}
+	dao, err := NewDynamoDBDaoForType(sess, reflect.TypeOf(CachedStruct{}))
+	require.NoError(t, err)
+	collector := NewMemoryMetricsCollector()
+	dao.SetMetricsCollector(collector)
+
+	_, err = dao.PutItem(&CachedStruct{Id: "1", Value: "a"})
+	require.NoError(t, err)
+	_, err = dao.GetItem(&CachedStruct{Id: "1"})
+	require.NoError(t, err)
+	page, err := dao.PagedQuery("", "{Id} = :id", "", map[string]interface{}{":id": "1"}, nil, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), page.TotalSize)
+
+	summary := collector.Summary()
+	for _, operation := range []string{OperationPutItem, OperationGetItem, OperationCountQuery, OperationQuery} {
+		totals := summary[MetricsKey{Table: "CachedStruct", Operation: operation}]
+		assert.Equal(t, int64(1), totals.Calls, operation)
+		assert.True(t, totals.CapacityUnits > 0, operation)
+	}
+	assert.Equal(t, int64(1), summary[MetricsKey{Table: "CachedStruct", Operation: OperationQuery}].Count)
+}
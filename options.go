@@ -0,0 +1,86 @@
+package dynamoDao
+
+import (
+	"errors"
+	"reflect"
+)
+
+// ReadOption customizes a single GetItem, PagedQuery or PagedScan call.
+type ReadOption func(*readOptions)
+
+type readOptions struct {
+	projectedFields  []string
+	projectionType   reflect.Type
+	consistentRead   *bool
+	scanIndexForward *bool
+	totalMode        *TotalMode
+	allowScan        bool
+	includeDeleted   bool
+}
+
+// ProjectFields limits the attributes read to the given fields.  The names may be either the Go field names (e.g.
+// PhoneNumber or Address.City) or the attribute names given in the 'dynamodbav' tag (e.g. phone_number).  Fields that
+// are not projected are left at their zero value in the results.
+func ProjectFields(fields ...string) ReadOption {
+	return func(ro *readOptions) {
+		ro.projectedFields = append(ro.projectedFields, fields...)
+	}
+}
+
+// ProjectInto limits the attributes read to those of the given struct and unmarshals the results into it instead of
+// the DAO's struct type.  The attribute names of the struct are determined by its 'dynamodbav' tags.
+func ProjectInto(t interface{}) ReadOption {
+	return ProjectIntoType(getStructType(t))
+}
+
+// ProjectIntoType is the same as ProjectInto but takes the reflect.Type of the struct.
+func ProjectIntoType(structType reflect.Type) ReadOption {
+	return func(ro *readOptions) {
+		ro.projectionType = structType
+	}
+}
+
+// ConsistentRead requests a strongly consistent read, overriding the DAO's default (see SetConsistentRead).  Strongly
+// consistent reads are not supported on global secondary indexes.
+func ConsistentRead(consistent bool) ReadOption {
+	return func(ro *readOptions) {
+		ro.consistentRead = &consistent
+	}
+}
+
+// ScanIndexForward sets the order a query returns its results in, overriding the DAO's default (see
+// SetScanIndexForward).  When false, results are returned in descending order of the range key.  It is not supported
+// by scans.
+func ScanIndexForward(forward bool) ReadOption {
+	return func(ro *readOptions) {
+		ro.scanIndexForward = &forward
+	}
+}
+
+func newReadOptions(opts []ReadOption) *readOptions {
+	ro := new(readOptions)
+	for _, opt := range opts {
+		opt(ro)
+	}
+	return ro
+}
+
+// Determines whether the read should be strongly consistent.  A strongly consistent read explicitly requested on a
+// global secondary index is an error, but the DAO's default is simply not applied to them.
+func (dao *DynamoDBDao) consistentReadFor(ro *readOptions, indexName string) (bool, error) {
+	isGlobal := indexName != "" && dao.findGlobalIndex(indexName) != nil
+	if ro.consistentRead != nil {
+		if *ro.consistentRead && isGlobal {
+			return false, errors.New("consistent reads are not supported on global secondary index: " + indexName)
+		}
+		return *ro.consistentRead, nil
+	}
+	return dao.consistentRead && !isGlobal, nil
+}
+
+func (dao *DynamoDBDao) scanIndexForwardFor(ro *readOptions) bool {
+	if ro.scanIndexForward != nil {
+		return *ro.scanIndexForward
+	}
+	return !dao.descending
+}
@@ -0,0 +1,58 @@
+package dynamoDao
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestConsistentReadFor(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	consistent, err := dao.consistentReadFor(newReadOptions(nil), "")
+	require.NoError(t, err)
+	assert.False(t, consistent)
+
+	consistent, err = dao.consistentReadFor(newReadOptions([]ReadOption{ConsistentRead(true)}), "")
+	require.NoError(t, err)
+	assert.True(t, consistent)
+
+	_, err = dao.consistentReadFor(newReadOptions([]ReadOption{ConsistentRead(true)}), "Foo")
+	assert.Error(t, err)
+
+	dao.SetConsistentRead(true)
+	consistent, err = dao.consistentReadFor(newReadOptions(nil), "")
+	require.NoError(t, err)
+	assert.True(t, consistent)
+
+	consistent, err = dao.consistentReadFor(newReadOptions(nil), "Foo")
+	require.NoError(t, err)
+	assert.False(t, consistent)
+
+	consistent, err = dao.consistentReadFor(newReadOptions([]ReadOption{ConsistentRead(false)}), "")
+	require.NoError(t, err)
+	assert.False(t, consistent)
+}
+
+func TestConsistentReadForLocalIndex(t *testing.T) {
+	dao := newTestDao(t, "TestStructWithLSI", reflect.TypeOf(TestStructWithLSI{}))
+
+	consistent, err := dao.consistentReadFor(newReadOptions([]ReadOption{ConsistentRead(true)}), "fubar")
+	require.NoError(t, err)
+	assert.True(t, consistent)
+}
+
+func TestScanIndexForwardFor(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	assert.True(t, dao.scanIndexForwardFor(newReadOptions(nil)))
+	assert.False(t, dao.scanIndexForwardFor(newReadOptions([]ReadOption{ScanIndexForward(false)})))
+
+	dao.SetScanIndexForward(false)
+	assert.False(t, dao.scanIndexForwardFor(newReadOptions(nil)))
+	assert.True(t, dao.scanIndexForwardFor(newReadOptions([]ReadOption{ScanIndexForward(true)})))
+
+	_, err := dao.PagedScan("Foo", 0, 10, ScanIndexForward(false))
+	assert.Error(t, err)
+}
@@ -0,0 +1,84 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Builds the ProjectionExpression for the given read options, adding any aliases needed to attrNames.  The
+// alwaysProject attributes (e.g. the key attributes needed to build the LastItemToken) are included whenever there is
+// a projection, as is the type attribute once types are registered so that each item is read as its own type.  An
+// empty expression is returned if all attributes should be read.
+func (dao *DynamoDBDao) projectionExpression(ro *readOptions, alwaysProject []string,
+	attrNames map[string]*string) (string, error) {
+	if len(ro.projectedFields) == 0 && ro.projectionType == nil {
+		return "", nil
+	}
+	projected := make(map[string]bool)
+	for _, field := range ro.projectedFields {
+		attrPath, err := dao.resolveAttributeName(field)
+		if err != nil {
+			return "", err
+		}
+		projected[attrPath] = true
+	}
+	if ro.projectionType != nil {
+		for _, attrPath := range attributeNamesForType(ro.projectionType) {
+			// Nested structs are read whole.
+			if !strings.Contains(attrPath, ".") {
+				projected[attrPath] = true
+			}
+		}
+	}
+	for _, attrPath := range alwaysProject {
+		projected[attrPath] = true
+	}
+	if len(dao.types) > 0 {
+		projected[dao.typeAttribute] = true
+	}
+	paths := make([]string, 0, len(projected))
+	for attrPath := range projected {
+		paths = append(paths, attrPath)
+	}
+	sort.Strings(paths)
+	for i, attrPath := range paths {
+		paths[i] = aliasAttrPath(attrPath, attrNames)
+	}
+	return strings.Join(paths, ", "), nil
+}
+
+// Unmarshals the attributes into the projection type given in the read options or, if there isn't one, into the
+// DAO's struct type, calling the AfterLoader hook of either.
+func (dao *DynamoDBDao) unmarshalProjection(ro *readOptions,
+	attributes map[string]*dynamodb.AttributeValue) (interface{}, error) {
+	if ro.projectionType == nil {
+		return dao.UnmarshalAttributes(attributes)
+	}
+	attributes, err := dao.unscopeAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+	ptrT := reflect.New(ro.projectionType).Interface()
+	err = dynamodbattribute.UnmarshalMap(attributes, ptrT)
+	if err != nil {
+		return nil, err
+	}
+	if err := dao.checkTenant(ptrT); err != nil {
+		return nil, err
+	}
+	if err := afterLoad(ptrT); err != nil {
+		return nil, err
+	}
+	return ptrT, nil
+}
+
+func copyAttrNames(attrNames map[string]*string) map[string]*string {
+	attrNamesCopy := make(map[string]*string, len(attrNames))
+	for alias, attrName := range attrNames {
+		attrNamesCopy[alias] = attrName
+	}
+	return attrNamesCopy
+}
@@ -0,0 +1,80 @@
+package dynamoDao
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+type TestStructSummary struct {
+	A string `dynamodbav:"a"`
+	N string `dynamodbav:"n"`
+}
+
+func TestAttributeNames(t *testing.T) {
+	names := attributeNamesForType(reflect.TypeOf(TestStruct{}))
+	assert.Equal(t, "a", names["A"])
+	assert.Equal(t, "B", names["B"])
+	assert.Equal(t, "f", names["F"])
+	assert.Equal(t, "f.G", names["F.G"])
+	assert.Equal(t, "f.L", names["F.L"])
+	assert.Equal(t, "n", names["N"])
+	_, ok := names["M"]
+	assert.False(t, ok)
+}
+
+func TestProjectionExpression(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	attrNames := make(map[string]*string)
+	projection, err := dao.projectionExpression(newReadOptions(nil), dao.keyAttrNames, attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "", projection)
+	assert.Empty(t, attrNames)
+
+	projection, err = dao.projectionExpression(newReadOptions([]ReadOption{ProjectFields("N", "c", "F.G")}),
+		dao.keyAttrNames, attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "#A, #B, #C, #D.#E, #F", projection)
+	assert.Equal(t, "B", *attrNames["#A"])
+	assert.Equal(t, "a", *attrNames["#B"])
+	assert.Equal(t, "c", *attrNames["#C"])
+	assert.Equal(t, "f", *attrNames["#D"])
+	assert.Equal(t, "G", *attrNames["#E"])
+	assert.Equal(t, "n", *attrNames["#F"])
+
+	attrNames = make(map[string]*string)
+	projection, err = dao.projectionExpression(newReadOptions([]ReadOption{ProjectInto(TestStructSummary{})}),
+		nil, attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "#A, #B", projection)
+	assert.Equal(t, "a", *attrNames["#A"])
+	assert.Equal(t, "n", *attrNames["#B"])
+
+	_, err = dao.projectionExpression(newReadOptions([]ReadOption{ProjectFields("Nope")}), nil, attrNames)
+	assert.Error(t, err)
+}
+
+func TestDynamoDBDao_PagedQueryWithProjection(t *testing.T) {
+	dao := resetAndFillTable(t)
+
+	queryValues := map[string]interface{}{":a": "2", ":b": 0}
+	searchPage, err := dao.dao.PagedQuery("", "{a} = :a and {B} > :b", "", queryValues, nil, 0, 50,
+		ProjectInto(TestStructSummary{}))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(searchPage.Data))
+	summary, ok := searchPage.Data[0].(*TestStructSummary)
+	require.True(t, ok)
+	assert.Equal(t, "2", summary.A)
+	assert.Equal(t, "barbell", summary.N)
+
+	item, err := dao.dao.GetItem(&TestStruct{A: "2", B: 23}, ProjectFields("N"))
+	require.NoError(t, err)
+	require.NotNil(t, item)
+	partial, ok := item.(*TestStruct)
+	require.True(t, ok)
+	assert.Equal(t, "barbell", partial.N)
+	assert.Equal(t, "", partial.A)
+	assert.Equal(t, float32(0), partial.C)
+}
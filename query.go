@@ -1,17 +1,13 @@
 package dynamoDao
 
 import (
-	"bytes"
-	"compress/lzw"
-	"encoding/base64"
-	"encoding/json"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"log"
-	"regexp"
-	"strings"
+	"strconv"
 )
 
+// A page of results from PagedQuery or PagedScan.  TotalSize is the number of items matching the search, computed
+// according to the TotalMode used.  It is -1 for TotalNone.
 type SearchPage struct {
 	PageOffset    int64
 	PageSize      int64
@@ -20,37 +16,59 @@ type SearchPage struct {
 	Data          []interface{}
 }
 
-var (
-	attrNameTokenRegex = regexp.MustCompile("\\{[^}]+\\}")
-)
-
-const (
-	logQuery = false
-)
-
 /*
  * Searches the given index name with the given query.  The query can only use operations supported by DynamoDb Queries.
  * see http://docs.aws.amazon.com/amazondynamodb/latest/developerguide/Query.html
  * The field names may be mapped by terms surrounded by {} (e.g. {Name}), and they will be mapped to the corresponding
- * fields.  However you can refer to field names directly.  Keep in mind that Dynamo has a large number of reserved
- * words so if your field names conflict with any of those, you must enclose them in {}.  See:
+ * fields.  Either the Go field name (e.g. {PhoneNumber}) or the attribute name (e.g. {phone_number}) may be used, and
+ * an error is returned if it is neither.  However you can refer to attribute names directly (e.g. name = :n).  Bare
+ * names that are one of Dynamo's reserved words or contain special characters (e.g. first-name) are aliased
+ * automatically, so they need not be enclosed in {}.  See:
  * http://docs.aws.amazon.com/amazondynamodb/latest/developerguide/ReservedWords.html
  * The input parameter names will be mapped the same way as described in the above referenced documentation with the
  * value set to the values defined in the queryValues parameter.
+ * The attributes read and the type the results are unmarshaled into may be changed with the ProjectFields and
+ * ProjectInto options.  The ConsistentRead and ScanIndexForward options override the DAO's defaults for the
+ * consistency and order of the results.
+ * Items that have been soft deleted (see DeleteItem) are filtered out unless the IncludeDeleted option is given.
+ * The lastItemToken must be the LastItemToken of a previous page of the same query, any other token results in an
+ * *InvalidTokenError.  When it is given, the pageOffset is ignored.
  */
 func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression string,
-	queryValues map[string]interface{}, lastItemToken *string, pageOffset, pageSize int64) (*SearchPage, error) {
+	queryValues map[string]interface{}, lastItemToken *string, pageOffset, pageSize int64,
+	opts ...ReadOption) (*SearchPage, error) {
+	ro := newReadOptions(opts)
+
+	consistentRead, err := dao.consistentReadFor(ro, indexName)
+	if err != nil {
+		return nil, err
+	}
+
+	keyAttrs := dao.indexKeyAttrNames(indexName)
+	filterExpression = dao.excludeDeleted(ro, filterExpression)
 
-	attrNames := make(map[string]*string)
-	keyExpression = extractAttrNameAliasesFromExpression(keyExpression, attrNames)
-	filterExpression = extractAttrNameAliasesFromExpression(filterExpression, attrNames)
 	paramValues, err := dynamodbattribute.MarshalMap(queryValues)
 	if err != nil {
 		return nil, err
 	}
+	signature, err := countSignature([]string{"query", indexName, keyExpression, filterExpression,
+		strconv.FormatBool(consistentRead)}, paramValues)
+	if err != nil {
+		return nil, err
+	}
+	binding := []string{"query", indexName, keyExpression, filterExpression}
+	attrNames := make(map[string]*string)
+	keyExpression, err = dao.extractAttrNameAliasesFromExpression(keyExpression, attrNames)
+	if err != nil {
+		return nil, err
+	}
+	filterExpression, err = dao.extractAttrNameAliasesFromExpression(filterExpression, attrNames)
+	if err != nil {
+		return nil, err
+	}
 	countQuery := new(dynamodb.QueryInput).
 		SetTableName(dao.TableName).
-		SetConsistentRead(false).
+		SetConsistentRead(consistentRead).
 		SetExpressionAttributeNames(attrNames).
 		SetKeyConditionExpression(keyExpression).
 		SetExpressionAttributeValues(paramValues).
@@ -61,18 +79,29 @@ func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression st
 	if filterExpression != "" {
 		countQuery = countQuery.SetFilterExpression(filterExpression)
 	}
-	if logQuery {
-		log.Printf("countQuery = %+v", countQuery)
+	totalSize, err := dao.totalSize(dao.totalModeFor(ro), indexName, signature, func() (int64, error) {
+		count := int64(0)
+		err := dao.queryPages(OperationCountQuery, countQuery, func(result *dynamodb.QueryOutput, lastPage bool) bool {
+			count += *result.Count
+			return true
+		})
+		return count, err
+	})
+	if err != nil {
+		return nil, err
 	}
-	countResult, err := dao.Client.Query(countQuery)
+	// The projection's aliases must not leak into the count query's names, DynamoDB rejects unused names.
+	queryAttrNames := copyAttrNames(attrNames)
+	projection, err := dao.projectionExpression(ro, keyAttrs, queryAttrNames)
 	if err != nil {
 		return nil, err
 	}
 	query := new(dynamodb.QueryInput).
 		SetTableName(dao.TableName).
-		SetConsistentRead(false).
+		SetConsistentRead(consistentRead).
+		SetScanIndexForward(dao.scanIndexForwardFor(ro)).
 		SetLimit(int64(pageSize)).
-		SetExpressionAttributeNames(attrNames).
+		SetExpressionAttributeNames(queryAttrNames).
 		SetKeyConditionExpression(keyExpression).
 		SetExpressionAttributeValues(paramValues)
 	if indexName != "" {
@@ -81,8 +110,11 @@ func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression st
 	if filterExpression != "" {
 		query = query.SetFilterExpression(filterExpression)
 	}
+	if projection != "" {
+		query = query.SetProjectionExpression(projection)
+	}
 	firstItemToProcess := int64(0)
-	lastItemKey, err := tokenToKey(lastItemToken)
+	lastItemKey, err := dao.tokenToKey(binding, lastItemToken)
 	if err != nil {
 		return nil, err
 	}
@@ -93,30 +125,18 @@ func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression st
 		firstItemToProcess = pageSize * pageOffset
 	}
 	page := &SearchPage{
-		PageSize: pageSize, PageOffset: pageOffset, TotalSize: int64(*countResult.Count),
+		PageSize: pageSize, PageOffset: pageOffset, TotalSize: totalSize,
 		Data: make([]interface{}, 0, pageSize),
 	}
 
-	keyAttrs := dao.keyAttrNames
-	if indexName != "" {
-		for _, gsi := range dao.tableDescription.GlobalSecondaryIndexes {
-			if *gsi.IndexName == indexName {
-				keyAttrs := make([]string, 0, 2)
-				for _, ks := range gsi.KeySchema {
-					keyAttrs = append(keyAttrs, *ks.AttributeName)
-				}
-			}
-		}
-	}
 	itemIndex := int64(0)
-	if logQuery {
-		log.Printf("query = %+v", query)
-	}
-	err = dao.Client.QueryPages(query, func(result *dynamodb.QueryOutput, lastPage bool) bool {
+	var itemErr error
+	err = dao.queryPages(OperationQuery, query, func(result *dynamodb.QueryOutput, lastPage bool) bool {
 		for _, item := range result.Items {
 			if itemIndex >= firstItemToProcess {
-				ptrT, err := dao.UnmarshalAttributes(item)
-				if err != nil {
+				var ptrT interface{}
+				ptrT, itemErr = dao.unmarshalProjection(ro, item)
+				if itemErr != nil {
 					return false
 				}
 				page.Data = append(page.Data, ptrT)
@@ -125,7 +145,7 @@ func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression st
 					for _, name := range keyAttrs {
 						keyAttrValues[name] = item[name]
 					}
-					page.LastItemToken, err = keyToToken(keyAttrValues)
+					page.LastItemToken, itemErr = dao.keyToToken(binding, keyAttrValues)
 
 					return false
 				}
@@ -134,86 +154,8 @@ func (dao *DynamoDBDao) PagedQuery(indexName, keyExpression, filterExpression st
 		}
 		return !lastPage && int64(len(page.Data)) < pageSize
 	})
-	return page, err
-}
-
-func extractAttrNameAliasesFromExpression(expression string, attrNames map[string]*string) string {
-	attrNamesFound := attrNameTokenRegex.FindAllString(expression, -1)
-	if attrNamesFound != nil {
-		nextSubstituteNameChar := uint8(65) // Start with A
-		for k, _ := range attrNames {
-			if k[1] >= nextSubstituteNameChar {
-				nextSubstituteNameChar = k[1] + 1
-			}
-		}
-		for _, attrNameToken := range attrNamesFound {
-			attrName := attrNameToken[1 : len(attrNameToken)-1]
-			substituteName := string([]byte{0x23, nextSubstituteNameChar})
-			nextSubstituteNameChar += 1
-			for subName, attrNamePtr := range attrNames {
-				if *attrNamePtr == attrName {
-					substituteName = subName
-					break
-				}
-			}
-			attrNames[substituteName] = &attrName
-
-			expression = strings.Replace(expression, attrNameToken, substituteName, -1)
-		}
-	}
-	return expression
-
-}
-
-func decompress(in string) (out string, err error) {
-	decoded, err := base64.StdEncoding.DecodeString(in)
-	if err != nil {
-		return
-	}
-	decodedBuf := bytes.NewBuffer(decoded)
-	lzwReader := lzw.NewReader(decodedBuf, lzw.LSB, 8)
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(lzwReader)
-	if err != nil {
-		return
-	}
-	lzwReader.Close()
-	out = buf.String()
-	return
-}
-
-func compress(in string) (out string, err error) {
-	buf := new(bytes.Buffer)
-	lzwWriter := lzw.NewWriter(buf, lzw.LSB, 8)
-	_, err = lzwWriter.Write([]byte(in))
-	if err != nil {
-		return
-	}
-	lzwWriter.Close()
-	out = base64.StdEncoding.EncodeToString(buf.Bytes())
-	return
-}
-
-func tokenToKey(lastItemToken *string) (map[string]*dynamodb.AttributeValue, error) {
-	var lastItemKey map[string]*dynamodb.AttributeValue
-	if lastItemToken != nil {
-		startingPointJson, err := decompress(*lastItemToken)
-		if err != nil {
-			return nil, err
-		}
-		json.Unmarshal([]byte(startingPointJson), &lastItemKey)
-	}
-	return lastItemKey, nil
-}
-
-func keyToToken(lastItemKey map[string]*dynamodb.AttributeValue) (*string, error) {
-	lastItemKeyJson, err := json.Marshal(lastItemKey)
-	if err != nil {
-		return nil, err
+	if err == nil {
+		err = itemErr
 	}
-	lastItemToken, err := compress(string(lastItemKeyJson))
-	if err != nil {
-		return nil, err
-	}
-	return &lastItemToken, nil
+	return page, err
 }
@@ -0,0 +1,313 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+const (
+	defaultQueryPageSize = int64(50)
+)
+
+// QueryBuilder builds the key condition, filter, and values of a PagedQuery from typed conditions.  For example:
+//
+//	page, err := dao.Query().Index("Foo").Key("a").Eq(x).Range("B").Gt(y).Filter("c").BeginsWith("x").Limit(50).Execute()
+//
+// Attributes may be given by their Go field names or their attribute names, and the names and values are aliased
+// automatically.  The attributes given to Key and Range are checked against the key schema of the index (or table)
+// before anything is sent to DynamoDB.  Any error found while building the query is returned by Execute or Build.
+type QueryBuilder struct {
+	dao              *DynamoDBDao
+	indexName        string
+	hashKey          string
+	rangeKey         string
+	keyConditions    []string
+	filterAttrs      []string
+	filterConditions []string
+	queryValues      map[string]interface{}
+	lastItemToken    *string
+	pageOffset       int64
+	pageSize         int64
+	options          []ReadOption
+	groupBy          []string
+	err              error
+}
+
+// KeyCondition is the condition on the hash key of a query, which must be an equality.
+type KeyCondition struct {
+	qb       *QueryBuilder
+	attrPath string
+}
+
+// RangeCondition is the condition on the range key of a query.
+type RangeCondition struct {
+	qb       *QueryBuilder
+	attrPath string
+}
+
+// FilterCondition is a condition on a non-key attribute applied to the items read by a query.
+type FilterCondition struct {
+	qb       *QueryBuilder
+	attrPath string
+}
+
+// Starts building a query on the table.
+func (dao *DynamoDBDao) Query() *QueryBuilder {
+	return &QueryBuilder{
+		dao:         dao,
+		queryValues: make(map[string]interface{}),
+		pageSize:    defaultQueryPageSize,
+	}
+}
+
+// Queries the given index instead of the table.
+func (qb *QueryBuilder) Index(indexName string) *QueryBuilder {
+	qb.indexName = indexName
+	return qb
+}
+
+// Starts the condition on the hash key of the index.
+func (qb *QueryBuilder) Key(attr string) *KeyCondition {
+	attrPath := qb.resolve(attr)
+	if qb.hashKey != "" {
+		qb.fail(errors.New("query builder: multiple hash key conditions"))
+	}
+	qb.hashKey = attrPath
+	return &KeyCondition{qb: qb, attrPath: attrPath}
+}
+
+// Starts the condition on the range key of the index.
+func (qb *QueryBuilder) Range(attr string) *RangeCondition {
+	attrPath := qb.resolve(attr)
+	if qb.rangeKey != "" {
+		qb.fail(errors.New("query builder: multiple range key conditions"))
+	}
+	qb.rangeKey = attrPath
+	return &RangeCondition{qb: qb, attrPath: attrPath}
+}
+
+// Starts a filter condition.  Multiple filter conditions are combined with 'and'.
+func (qb *QueryBuilder) Filter(attr string) *FilterCondition {
+	attrPath := qb.resolve(attr)
+	qb.filterAttrs = append(qb.filterAttrs, attrPath)
+	return &FilterCondition{qb: qb, attrPath: attrPath}
+}
+
+// Sets the page size, the default is 50.
+func (qb *QueryBuilder) Limit(pageSize int64) *QueryBuilder {
+	qb.pageSize = pageSize
+	return qb
+}
+
+// Sets the page to read, ignored if StartAfter is given a token.
+func (qb *QueryBuilder) Offset(pageOffset int64) *QueryBuilder {
+	qb.pageOffset = pageOffset
+	return qb
+}
+
+// Continues from the LastItemToken of a previous page of the same query.
+func (qb *QueryBuilder) StartAfter(lastItemToken *string) *QueryBuilder {
+	qb.lastItemToken = lastItemToken
+	return qb
+}
+
+// Adds read options (e.g. ProjectFields or ConsistentRead) to the query.
+func (qb *QueryBuilder) Options(opts ...ReadOption) *QueryBuilder {
+	qb.options = append(qb.options, opts...)
+	return qb
+}
+
+// Validates the query and returns the arguments for PagedQuery.
+func (qb *QueryBuilder) Build() (indexName, keyExpression, filterExpression string,
+	queryValues map[string]interface{}, err error) {
+	if qb.err != nil {
+		return "", "", "", nil, qb.err
+	}
+	keySchema, err := qb.dao.indexKeySchema(qb.indexName)
+	if err != nil {
+		return "", "", "", nil, errors.New("query builder: " + err.Error())
+	}
+	hashKey, rangeKey := "", ""
+	for _, ks := range keySchema {
+		switch *ks.KeyType {
+		case dynamodb.KeyTypeHash:
+			hashKey = *ks.AttributeName
+		case dynamodb.KeyTypeRange:
+			rangeKey = *ks.AttributeName
+		}
+	}
+	if qb.hashKey == "" {
+		return "", "", "", nil, errors.New("query builder: a condition on the hash key " + hashKey + " is required")
+	}
+	if qb.hashKey != hashKey {
+		return "", "", "", nil, fmt.Errorf("query builder: %s is not the hash key of %s, %s is",
+			qb.hashKey, qb.indexDescription(), hashKey)
+	}
+	if qb.rangeKey != "" && qb.rangeKey != rangeKey {
+		if rangeKey == "" {
+			return "", "", "", nil, fmt.Errorf("query builder: %s does not have a range key", qb.indexDescription())
+		}
+		return "", "", "", nil, fmt.Errorf("query builder: %s is not the range key of %s, %s is",
+			qb.rangeKey, qb.indexDescription(), rangeKey)
+	}
+	for _, attrPath := range qb.filterAttrs {
+		if attrPath == hashKey || attrPath == rangeKey {
+			return "", "", "", nil, fmt.Errorf("query builder: %s is a key of %s and cannot be filtered on",
+				attrPath, qb.indexDescription())
+		}
+	}
+	return qb.indexName, strings.Join(qb.keyConditions, " and "), strings.Join(qb.filterConditions, " and "),
+		qb.queryValues, nil
+}
+
+// Validates and runs the query, returning the requested page.
+func (qb *QueryBuilder) Execute() (*SearchPage, error) {
+	indexName, keyExpression, filterExpression, queryValues, err := qb.Build()
+	if err != nil {
+		return nil, err
+	}
+	return qb.dao.PagedQuery(indexName, keyExpression, filterExpression, queryValues, qb.lastItemToken,
+		qb.pageOffset, qb.pageSize, qb.options...)
+}
+
+func (qb *QueryBuilder) indexDescription() string {
+	if qb.indexName == "" {
+		return "table " + qb.dao.TableName
+	}
+	return "index " + qb.indexName
+}
+
+func (qb *QueryBuilder) fail(err error) {
+	if qb.err == nil {
+		qb.err = err
+	}
+}
+
+func (qb *QueryBuilder) resolve(attr string) string {
+	attrPath, err := qb.dao.resolveAttributeName(attr)
+	if err != nil {
+		qb.fail(errors.New("query builder: " + err.Error()))
+		return attr
+	}
+	return attrPath
+}
+
+// Adds the value to the query and returns its placeholder.
+func (qb *QueryBuilder) value(v interface{}) string {
+	placeholder := fmt.Sprintf(":v%d", len(qb.queryValues))
+	qb.queryValues[placeholder] = v
+	return placeholder
+}
+
+func (qb *QueryBuilder) comparison(attrPath, operator string, v interface{}) string {
+	return attrPathExpression(attrPath) + " " + operator + " " + qb.value(v)
+}
+
+func (qb *QueryBuilder) between(attrPath string, low, high interface{}) string {
+	return attrPathExpression(attrPath) + " between " + qb.value(low) + " and " + qb.value(high)
+}
+
+func (qb *QueryBuilder) function(name, attrPath string, v interface{}) string {
+	return name + "(" + attrPathExpression(attrPath) + ", " + qb.value(v) + ")"
+}
+
+func (kc *KeyCondition) Eq(v interface{}) *QueryBuilder {
+	kc.qb.keyConditions = append(kc.qb.keyConditions, kc.qb.comparison(kc.attrPath, "=", v))
+	return kc.qb
+}
+
+func (rc *RangeCondition) add(condition string) *QueryBuilder {
+	rc.qb.keyConditions = append(rc.qb.keyConditions, condition)
+	return rc.qb
+}
+
+func (rc *RangeCondition) Eq(v interface{}) *QueryBuilder {
+	return rc.add(rc.qb.comparison(rc.attrPath, "=", v))
+}
+
+func (rc *RangeCondition) Lt(v interface{}) *QueryBuilder {
+	return rc.add(rc.qb.comparison(rc.attrPath, "<", v))
+}
+
+func (rc *RangeCondition) Le(v interface{}) *QueryBuilder {
+	return rc.add(rc.qb.comparison(rc.attrPath, "<=", v))
+}
+
+func (rc *RangeCondition) Gt(v interface{}) *QueryBuilder {
+	return rc.add(rc.qb.comparison(rc.attrPath, ">", v))
+}
+
+func (rc *RangeCondition) Ge(v interface{}) *QueryBuilder {
+	return rc.add(rc.qb.comparison(rc.attrPath, ">=", v))
+}
+
+func (rc *RangeCondition) Between(low, high interface{}) *QueryBuilder {
+	return rc.add(rc.qb.between(rc.attrPath, low, high))
+}
+
+func (rc *RangeCondition) BeginsWith(prefix interface{}) *QueryBuilder {
+	return rc.add(rc.qb.function("begins_with", rc.attrPath, prefix))
+}
+
+func (fc *FilterCondition) add(condition string) *QueryBuilder {
+	fc.qb.filterConditions = append(fc.qb.filterConditions, condition)
+	return fc.qb
+}
+
+func (fc *FilterCondition) Eq(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, "=", v))
+}
+
+func (fc *FilterCondition) Ne(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, "<>", v))
+}
+
+func (fc *FilterCondition) Lt(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, "<", v))
+}
+
+func (fc *FilterCondition) Le(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, "<=", v))
+}
+
+func (fc *FilterCondition) Gt(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, ">", v))
+}
+
+func (fc *FilterCondition) Ge(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.comparison(fc.attrPath, ">=", v))
+}
+
+func (fc *FilterCondition) Between(low, high interface{}) *QueryBuilder {
+	return fc.add(fc.qb.between(fc.attrPath, low, high))
+}
+
+func (fc *FilterCondition) BeginsWith(prefix interface{}) *QueryBuilder {
+	return fc.add(fc.qb.function("begins_with", fc.attrPath, prefix))
+}
+
+func (fc *FilterCondition) Contains(v interface{}) *QueryBuilder {
+	return fc.add(fc.qb.function("contains", fc.attrPath, v))
+}
+
+func (fc *FilterCondition) In(values ...interface{}) *QueryBuilder {
+	if len(values) == 0 {
+		fc.qb.fail(errors.New("query builder: In requires at least one value"))
+		return fc.qb
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = fc.qb.value(v)
+	}
+	return fc.add(attrPathExpression(fc.attrPath) + " in (" + strings.Join(placeholders, ", ") + ")")
+}
+
+func (fc *FilterCondition) Exists() *QueryBuilder {
+	return fc.add("attribute_exists(" + attrPathExpression(fc.attrPath) + ")")
+}
+
+func (fc *FilterCondition) NotExists() *QueryBuilder {
+	return fc.add("attribute_not_exists(" + attrPathExpression(fc.attrPath) + ")")
+}
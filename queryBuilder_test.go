@@ -0,0 +1,60 @@
+package dynamoDao
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestQueryBuilder_Build(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	indexName, keyExpression, filterExpression, queryValues, err := dao.Query().Index("Foo").
+		Key("A").Eq("3").Range("B").Gt(-56).Filter("n").BeginsWith("snafu").Filter("F.G").In("foo", "fu").
+		Build()
+	require.NoError(t, err)
+	assert.Equal(t, "Foo", indexName)
+	assert.Equal(t, "{a} = :v0 and {B} > :v1", keyExpression)
+	assert.Equal(t, "begins_with({n}, :v2) and {f}.{G} in (:v3, :v4)", filterExpression)
+	assert.Equal(t, map[string]interface{}{":v0": "3", ":v1": -56, ":v2": "snafu", ":v3": "foo", ":v4": "fu"},
+		queryValues)
+
+	_, keyExpression, filterExpression, _, err = dao.Query().Key("a").Eq("1").Range("B").Between(1, 5).
+		Filter("c").Exists().Build()
+	require.NoError(t, err)
+	assert.Equal(t, "{a} = :v0 and {B} between :v1 and :v2", keyExpression)
+	assert.Equal(t, "attribute_exists({c})", filterExpression)
+}
+
+func TestQueryBuilder_BuildErrors(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	_, _, _, _, err := dao.Query().Index("Snafu").Key("a").Eq("1").Build()
+	assert.EqualError(t, err, "query builder: a is not the hash key of index Snafu, B is")
+	_, _, _, _, err = dao.Query().Index("Snafu").Key("B").Eq(1).Range("a").Eq("1").Build()
+	assert.EqualError(t, err, "query builder: a is not the range key of index Snafu, c is")
+	_, _, _, _, err = dao.Query().Range("B").Eq(1).Build()
+	assert.EqualError(t, err, "query builder: a condition on the hash key a is required")
+	_, _, _, _, err = dao.Query().Key("a").Eq("1").Key("a").Eq("2").Build()
+	assert.EqualError(t, err, "query builder: multiple hash key conditions")
+	_, _, _, _, err = dao.Query().Key("a").Eq("1").Filter("B").Eq(1).Build()
+	assert.EqualError(t, err, "query builder: B is a key of table TestStruct and cannot be filtered on")
+	_, _, _, _, err = dao.Query().Key("a").Eq("1").Filter("Nope").Eq(1).Build()
+	assert.EqualError(t, err, "query builder: unknown field or attribute: Nope")
+	_, _, _, _, err = dao.Query().Index("Nope").Key("a").Eq("1").Build()
+	assert.EqualError(t, err, "query builder: unknown index: Nope")
+
+	_, err = dao.Query().Index("Nope").Key("a").Eq("1").Execute()
+	assert.Error(t, err)
+}
+
+func TestDynamoDBDao_QueryBuilderExecute(t *testing.T) {
+	dao := resetAndFillTable(t)
+
+	searchPage, err := dao.dao.Query().Index("Foo").Key("A").Eq("3").Range("B").Gt(-56).Execute()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, searchPage.TotalSize)
+	require.Equal(t, 1, len(searchPage.Data))
+	assert.Equal(t, "snafubar", searchPage.Data[0].(*TestStruct).N)
+}
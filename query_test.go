@@ -1,9 +1,11 @@
 package dynamoDao
 
 import (
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/danapsimer/dynamoDao/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"reflect"
@@ -51,3 +53,122 @@ func TestDynamoDBDao_PagedQuery(t *testing.T) {
 	assert.EqualValues(t, int64(50), searchPage.PageSize)
 	assert.Nil(t, searchPage.LastItemToken)
 }
+
+func TestDynamoDBDao_PagedQueryDescending(t *testing.T) {
+	dao := resetAndFillTable(t)
+
+	queryValues := map[string]interface{}{":a": "1"}
+	searchPage, err := dao.dao.PagedQuery("Foo", "{a} = :a", "", queryValues, nil, 0, 50,
+		ScanIndexForward(false), ConsistentRead(false))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(searchPage.Data))
+
+	_, err = dao.dao.PagedQuery("Foo", "{a} = :a", "", queryValues, nil, 0, 50, ConsistentRead(true))
+	assert.Error(t, err)
+
+	searchPage, err = dao.dao.PagedQuery("", "{a} = :a", "", queryValues, nil, 0, 50, ConsistentRead(true))
+	require.NoError(t, err)
+	assert.Equal(t, 1, len(searchPage.Data))
+}
+
+type Struct3 struct {
+	OrgId string `dynamodbav:"organization_id" dynamoKey:"hash"`
+	Id    string `dynamodbav:"person_id" dynamoKey:"range"`
+	Name  string `dynamodbav:"name" dynamoLSI:"NameIdx,range"`
+}
+
+func TestIndexKeyAttrNames(t *testing.T) {
+	sess := session.New(awsConfig)
+	dao1, err := NewDynamoDBDao(sess, "Struct1", 0, 0, false, "", reflect.TypeOf(Struct1{}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"person_id", "name"}, dao1.indexKeyAttrNames(""))
+	assert.Equal(t, []string{"person_id", "name", "organization_id", "phone_number"},
+		dao1.indexKeyAttrNames("PhoneNumberIdx"))
+
+	dao3, err := NewDynamoDBDao(sess, "Struct3", 0, 0, false, "", reflect.TypeOf(Struct3{}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"organization_id", "person_id", "name"}, dao3.indexKeyAttrNames("NameIdx"))
+}
+
+// Reads every page of the query, checking that each is full except possibly the last, and returns all the items.
+func readAllPages(t *testing.T, dao *DynamoDBDao, indexName, keyExpression string,
+	queryValues map[string]interface{}, pageSize int64) []interface{} {
+	items := make([]interface{}, 0)
+	var lastItemToken *string
+	for pages := 0; pages < 10; pages++ {
+		page, err := dao.PagedQuery(indexName, keyExpression, "", queryValues, lastItemToken, 0, pageSize)
+		require.NoError(t, err)
+		items = append(items, page.Data...)
+		if page.LastItemToken == nil {
+			return items
+		}
+		require.EqualValues(t, pageSize, len(page.Data))
+		lastItemToken = page.LastItemToken
+	}
+	t.Fatal("too many pages")
+	return nil
+}
+
+func TestDynamoDBDao_PagedQueryGlobalIndexPages(t *testing.T) {
+	dao := setup(t)
+	orgId := uuid.NewV4()
+	for i := 0; i < 5; i++ {
+		id := uuid.NewV4()
+		_, err := dao.PutItem(&Struct1{Id: &id, OrgId: orgId, Name: fmt.Sprintf("Person %d", i),
+			PhoneNumber: fmt.Sprintf("404555121%d", i)})
+		require.NoError(t, err)
+	}
+
+	items := readAllPages(t, dao.DynamoDBDao, "PhoneNumberIdx", "{organization_id} = :o",
+		map[string]interface{}{":o": &orgId}, 2)
+	require.Equal(t, 5, len(items))
+	for i, item := range items {
+		assert.Equal(t, fmt.Sprintf("404555121%d", i), item.(*Struct1).PhoneNumber)
+	}
+}
+
+func TestDynamoDBDao_PagedQueryLocalIndexPages(t *testing.T) {
+	sess := session.New(awsConfig)
+	client := dynamodb.New(sess)
+	_, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String("Struct3")})
+	if err == nil {
+		_, err := client.DeleteTable(&dynamodb.DeleteTableInput{TableName: aws.String("Struct3")})
+		require.NoError(t, err)
+	}
+	dao, err := NewDynamoDBDaoForType(sess, reflect.TypeOf(Struct3{}))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := dao.PutItem(&Struct3{OrgId: "org", Id: fmt.Sprintf("%d", 5-i), Name: fmt.Sprintf("Person %d", i)})
+		require.NoError(t, err)
+	}
+
+	items := readAllPages(t, dao, "NameIdx", "{organization_id} = :o", map[string]interface{}{":o": "org"}, 2)
+	require.Equal(t, 5, len(items))
+	for i, item := range items {
+		assert.Equal(t, fmt.Sprintf("Person %d", i), item.(*Struct3).Name)
+	}
+}
+
+func TestExtractAttrNameAliasesFromExpression(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	attrNames := make(map[string]*string)
+	expression, err := dao.extractAttrNameAliasesFromExpression("{A} = :a and {B} > :b", attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "#A = :a and #B > :b", expression)
+	assert.Equal(t, "a", *attrNames["#A"])
+	assert.Equal(t, "B", *attrNames["#B"])
+
+	expression, err = dao.extractAttrNameAliasesFromExpression("{a} = :a and {F.G} = :g and {f}.{H} > :h", attrNames)
+	require.NoError(t, err)
+	assert.Equal(t, "#A = :a and #C.#D = :g and #C.#E > :h", expression)
+	assert.Equal(t, "f", *attrNames["#C"])
+	assert.Equal(t, "G", *attrNames["#D"])
+	assert.Equal(t, "H", *attrNames["#E"])
+
+	_, err = dao.extractAttrNameAliasesFromExpression("{a} = :a and {Nmae} = :n", attrNames)
+	assert.EqualError(t, err, "unknown attribute Nmae in expression: {a} = :a and {Nmae} = :n")
+
+	_, err = dao.PagedQuery("", "{a} = :a", "{Nmae} = :n", map[string]interface{}{":a": "1", ":n": "x"}, nil, 0, 10)
+	assert.Error(t, err)
+}
@@ -0,0 +1,194 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts         = 3
+	defaultRetryBaseDelay           = 50 * time.Millisecond
+	defaultRetryMaxThrottleAttempts = 8
+	defaultRetryThrottleBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay            = 5 * time.Second
+)
+
+// ErrCircuitOpen is returned without sending the request while a RetryPolicy's circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open: requests are being throttled")
+
+// RetryPolicy decides which failed requests the DAO sends again and when (see SetRetryPolicy).  Throttled requests
+// (e.g. ProvisionedThroughputExceededException) and transient failures (5xx responses, timeouts and connection errors)
+// are retried separately, each up to its own maximum number of attempts, after a delay growing exponentially from its
+// own base delay up to the maximum delay.  The delays are jittered: each is a random duration up to the exponential
+// one.  Other errors are not retried.
+//
+// An optional circuit breaker fails requests fast with ErrCircuitOpen once a number of consecutive attempts have been
+// throttled, until a cooldown has passed.  After the cooldown a single throttled attempt opens it again and a successful
+// one closes it.  The breaker's state is shared by every DAO using the policy.
+type RetryPolicy struct {
+	maxAttempts         int
+	baseDelay           time.Duration
+	maxThrottleAttempts int
+	throttleBaseDelay   time.Duration
+	maxDelay            time.Duration
+	breakerThreshold    int
+	breakerCooldown     time.Duration
+	sleep               func(time.Duration)
+
+	breaker              sync.Mutex
+	consecutiveThrottles int
+	openUntil            time.Time
+}
+
+// Creates a policy making up to 3 attempts for transient failures and 8 for throttling, with base delays of 50ms and
+// 100ms, a maximum delay of 5s, and no circuit breaker.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		maxAttempts:         defaultRetryMaxAttempts,
+		baseDelay:           defaultRetryBaseDelay,
+		maxThrottleAttempts: defaultRetryMaxThrottleAttempts,
+		throttleBaseDelay:   defaultRetryThrottleBaseDelay,
+		maxDelay:            defaultRetryMaxDelay,
+		sleep:               time.Sleep,
+	}
+}
+
+// Sets the maximum number of attempts, including the first, for requests failing transiently and the base delay of
+// their backoff.
+func (policy *RetryPolicy) SetMaxAttempts(maxAttempts int, baseDelay time.Duration) *RetryPolicy {
+	policy.maxAttempts = maxAttempts
+	policy.baseDelay = baseDelay
+	return policy
+}
+
+// Sets the maximum number of attempts, including the first, for throttled requests and the base delay of their
+// backoff.
+func (policy *RetryPolicy) SetMaxThrottleAttempts(maxAttempts int, baseDelay time.Duration) *RetryPolicy {
+	policy.maxThrottleAttempts = maxAttempts
+	policy.throttleBaseDelay = baseDelay
+	return policy
+}
+
+// Sets the longest delay between attempts.
+func (policy *RetryPolicy) SetMaxDelay(maxDelay time.Duration) *RetryPolicy {
+	policy.maxDelay = maxDelay
+	return policy
+}
+
+// Enables the circuit breaker, opening it for the cooldown after threshold consecutive throttled attempts.  A threshold
+// of zero disables it.
+func (policy *RetryPolicy) SetCircuitBreaker(threshold int, cooldown time.Duration) *RetryPolicy {
+	policy.breaker.Lock()
+	defer policy.breaker.Unlock()
+	policy.breakerThreshold = threshold
+	policy.breakerCooldown = cooldown
+	policy.consecutiveThrottles = 0
+	policy.openUntil = time.Time{}
+	return policy
+}
+
+// Sets the policy failed requests are retried with, replacing the retries of the SDK for the DAO's requests.  Nil (the
+// default) leaves retrying to the SDK.  The DAO's Client is left as it is, so other DAOs sharing it (e.g. those created
+// by ForTenant) keep their own retries.  Retries are logged at the warn level and counted in the metrics of the
+// request.
+func (dao *DynamoDBDao) SetRetryPolicy(policy *RetryPolicy) *DynamoDBDao {
+	dao.retryPolicy = policy
+	return dao
+}
+
+// Turns the SDK's retries off for a request, which the DAO's retry policy retries instead.
+func withoutSDKRetries(r *request.Request) {
+	r.Retryer = client.DefaultRetryer{NumMaxRetries: 0}
+}
+
+// Makes attempts with the call until it succeeds, fails with an error that is not retried, or runs out of attempts,
+// calling retrying before each retry.  Returns the output and error of the last attempt and the number of retries.
+func (policy *RetryPolicy) do(call func() (interface{}, error),
+	retrying func(attempt int, delay time.Duration, err error)) (interface{}, int, error) {
+	throttles, failures := 0, 0
+	for attempt := 1; ; attempt++ {
+		if err := policy.allow(); err != nil {
+			return nil, attempt - 1, err
+		}
+		output, err := call()
+		throttled := request.IsErrorThrottle(err)
+		policy.record(err, throttled)
+		var delay time.Duration
+		switch {
+		case err == nil:
+			return output, attempt - 1, nil
+		case throttled:
+			throttles++
+			if throttles >= policy.maxThrottleAttempts {
+				return output, attempt - 1, err
+			}
+			delay = policy.backoff(policy.throttleBaseDelay, throttles)
+		case isTransientError(err):
+			failures++
+			if failures >= policy.maxAttempts {
+				return output, attempt - 1, err
+			}
+			delay = policy.backoff(policy.baseDelay, failures)
+		default:
+			return output, attempt - 1, err
+		}
+		retrying(attempt, delay, err)
+		policy.sleep(delay)
+	}
+}
+
+// A random delay up to base * 2^(failures-1), capped at the maximum delay.
+func (policy *RetryPolicy) backoff(base time.Duration, failures int) time.Duration {
+	delay := base
+	for i := 1; i < failures && delay < policy.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.maxDelay {
+		delay = policy.maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+func (policy *RetryPolicy) allow() error {
+	policy.breaker.Lock()
+	defer policy.breaker.Unlock()
+	if policy.breakerThreshold > 0 && time.Now().Before(policy.openUntil) {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+func (policy *RetryPolicy) record(err error, throttled bool) {
+	policy.breaker.Lock()
+	defer policy.breaker.Unlock()
+	if policy.breakerThreshold <= 0 {
+		return
+	}
+	if throttled {
+		policy.consecutiveThrottles++
+		if policy.consecutiveThrottles >= policy.breakerThreshold {
+			policy.openUntil = time.Now().Add(policy.breakerCooldown)
+			// Half open once the cooldown has passed: the next throttled attempt opens it again.
+			policy.consecutiveThrottles = policy.breakerThreshold - 1
+		}
+	} else if err == nil {
+		policy.consecutiveThrottles = 0
+	}
+}
+
+// Whether the error is a transient failure worth retrying: a 5xx response other than 501, or an error the SDK
+// considers retryable, e.g. a timeout or connection error.
+func isTransientError(err error) bool {
+	if failure, ok := err.(awserr.RequestFailure); ok && failure.StatusCode() >= 500 && failure.StatusCode() != 501 {
+		return true
+	}
+	return request.IsErrorRetryable(err)
+}
@@ -0,0 +1,154 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	errThrottled = awserr.NewRequestFailure(
+		awserr.New(dynamodb.ErrCodeProvisionedThroughputExceededException, "slow down", nil), 400, "1")
+	errUnavailable = awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "try again", nil), 503, "2")
+	errInvalid     = awserr.NewRequestFailure(awserr.New("ValidationException", "bad request", nil), 400, "3")
+)
+
+// Returns a policy that records its delays instead of sleeping.
+func newTestRetryPolicy(delays *[]time.Duration) *RetryPolicy {
+	policy := NewRetryPolicy()
+	policy.sleep = func(delay time.Duration) {
+		*delays = append(*delays, delay)
+	}
+	return policy
+}
+
+// Sends a GetItem through the DAO, failing with the errors in turn before succeeding.
+func sendFailing(dao *DynamoDBDao, errs ...error) (int, error) {
+	calls := 0
+	_, err := dao.send(OperationGetItem, "", new(dynamodb.GetItemInput), func(...request.Option) (interface{}, error) {
+		calls++
+		if calls <= len(errs) {
+			return (*dynamodb.GetItemOutput)(nil), errs[calls-1]
+		}
+		return new(dynamodb.GetItemOutput), nil
+	})
+	return calls, err
+}
+
+// Returns the number of retries the SDK would make for a request sent by the DAO.
+func sdkMaxRetries(t *testing.T, dao *DynamoDBDao) int {
+	maxRetries := -1
+	getItem := new(dynamodb.GetItemInput)
+	_, err := dao.send(OperationGetItem, "", getItem, func(reqOpts ...request.Option) (interface{}, error) {
+		req, output := dao.Client.GetItemRequest(getItem)
+		req.ApplyOptions(reqOpts...)
+		maxRetries = req.MaxRetries()
+		return output, nil
+	})
+	require.NoError(t, err)
+	return maxRetries
+}
+
+func TestRetryPolicy(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	collector := NewMemoryMetricsCollector()
+	logger := new(memoryLogger)
+	delays := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(&delays).SetMaxAttempts(2, 10*time.Millisecond).
+		SetMaxThrottleAttempts(3, 20*time.Millisecond)
+	sdkRetries := sdkMaxRetries(t, dao)
+	assert.NotZero(t, sdkRetries)
+	sdkRetryer := dao.Client.Retryer
+	dao.SetRetryPolicy(policy)
+	assert.Equal(t, 0, sdkMaxRetries(t, dao))
+	assert.Equal(t, sdkRetryer, dao.Client.Retryer)
+	dao.SetMetricsCollector(collector).SetLogger(logger)
+
+	calls, err := sendFailing(dao, errThrottled, errUnavailable, errThrottled)
+	require.NoError(t, err)
+	assert.Equal(t, 4, calls)
+	require.Equal(t, 3, len(delays))
+	assert.True(t, delays[0] <= 20*time.Millisecond)
+	assert.True(t, delays[1] <= 10*time.Millisecond)
+	assert.True(t, delays[2] <= 40*time.Millisecond)
+	assert.Equal(t, 3, collector.Operations()[0].Retries)
+	assert.Equal(t, 3, len(logger.entries))
+	assert.Equal(t, LogWarn, logger.entries[0].level)
+	assert.Equal(t, "retrying request", logger.entries[0].message)
+
+	calls, err = sendFailing(dao, errUnavailable, errUnavailable, errUnavailable)
+	assert.True(t, errors.Is(err, errUnavailable))
+	assert.Equal(t, 2, calls)
+
+	calls, err = sendFailing(dao, errThrottled, errThrottled, errThrottled, errThrottled)
+	assert.True(t, errors.Is(err, errThrottled))
+	assert.Equal(t, 3, calls)
+
+	calls, err = sendFailing(dao, errInvalid)
+	assert.True(t, errors.Is(err, errInvalid))
+	assert.Equal(t, 1, calls)
+
+	calls, err = sendFailing(dao, errors.New("not an aws error"))
+	assert.EqualError(t, err, "GetItem Struct3: not an aws error")
+	assert.Equal(t, 1, calls)
+
+	summary := collector.Summary()[MetricsKey{Table: "Struct3", Operation: OperationGetItem}]
+	assert.Equal(t, int64(5), summary.Calls)
+	assert.Equal(t, int64(3+1+2), summary.Retries)
+
+	dao.SetRetryPolicy(nil)
+	assert.Equal(t, sdkRetries, sdkMaxRetries(t, dao))
+
+	// Setting a policy on a DAO scoped to a tenant, which shares the client, leaves the DAO it was scoped from alone.
+	scoped, err := dao.ForTenant("acme")
+	require.NoError(t, err)
+	scoped.SetRetryPolicy(NewRetryPolicy())
+	assert.Equal(t, 0, sdkMaxRetries(t, scoped))
+	assert.Equal(t, sdkRetries, sdkMaxRetries(t, dao))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := NewRetryPolicy().SetMaxDelay(time.Second)
+	for i := 0; i < 100; i++ {
+		assert.True(t, policy.backoff(100*time.Millisecond, 1) <= 100*time.Millisecond)
+		assert.True(t, policy.backoff(100*time.Millisecond, 3) <= 400*time.Millisecond)
+		assert.True(t, policy.backoff(100*time.Millisecond, 40) <= time.Second)
+	}
+	assert.Equal(t, time.Duration(0), policy.backoff(0, 3))
+}
+
+func TestRetryPolicyCircuitBreaker(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	delays := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(&delays).SetMaxThrottleAttempts(2, 0).SetCircuitBreaker(3, 50*time.Millisecond)
+	dao.SetLogger(nil).SetRetryPolicy(policy)
+
+	_, err := sendFailing(dao, errThrottled, errThrottled)
+	assert.True(t, errors.Is(err, errThrottled))
+	// The third consecutive throttle opens the breaker, so the retry fails fast.
+	calls, err := sendFailing(dao, errThrottled, errThrottled)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, 1, calls)
+	calls, err = sendFailing(dao)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, 0, calls)
+
+	// Half open after the cooldown: a single throttle opens it again.
+	time.Sleep(60 * time.Millisecond)
+	calls, err = sendFailing(dao, errThrottled)
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, 1, calls)
+
+	// A success closes it.
+	time.Sleep(60 * time.Millisecond)
+	_, err = sendFailing(dao)
+	require.NoError(t, err)
+	_, err = sendFailing(dao, errThrottled)
+	require.NoError(t, err)
+}
@@ -1,46 +1,133 @@
 package dynamoDao
 
-import "github.com/aws/aws-sdk-go/service/dynamodb"
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"strconv"
+)
 
-func (dod *DynamoDBDao) PagedScan(indexName string, pageOffset, pageSize int64) (*SearchPage, error) {
+// Scans the given index, or the table if the index name is empty.  Paging is handled the same way as in PagedQuery,
+// and soft deleted items are likewise left out unless the IncludeDeleted option is given.
+func (dod *DynamoDBDao) PagedScan(indexName string, pageOffset, pageSize int64, opts ...ReadOption) (*SearchPage, error) {
+	return dod.pagedScan(indexName, "", nil, nil, pageOffset, pageSize, opts...)
+}
+
+// Scans the given index, or the table if the index name is empty, for the items matching the filter expression.  The
+// filter expression and query values are handled the same way as in PagedQuery.
+func (dod *DynamoDBDao) pagedScan(indexName, filterExpression string, queryValues map[string]interface{},
+	lastItemToken *string, pageOffset, pageSize int64, opts ...ReadOption) (*SearchPage, error) {
+	ro := newReadOptions(opts)
+	if ro.scanIndexForward != nil {
+		return nil, errors.New("scans do not support ScanIndexForward")
+	}
+	consistentRead, err := dod.consistentReadFor(ro, indexName)
+	if err != nil {
+		return nil, err
+	}
+	filterExpression = dod.excludeDeleted(ro, filterExpression)
+	paramValues, err := dynamodbattribute.MarshalMap(queryValues)
+	if err != nil {
+		return nil, err
+	}
+	totalMode := dod.totalModeFor(ro)
+	signature, err := countSignature([]string{"scan", indexName, filterExpression,
+		strconv.FormatBool(consistentRead)}, paramValues)
+	if err != nil {
+		return nil, err
+	}
+	binding := []string{"scan", indexName, filterExpression}
+	attrNames := make(map[string]*string)
+	filterExpression, err = dod.extractAttrNameAliasesFromExpression(filterExpression, attrNames)
+	if err != nil {
+		return nil, err
+	}
 	countScan := new(dynamodb.ScanInput).
 		SetTableName(dod.TableName).
-		SetConsistentRead(false).
-		SetIndexName(indexName).
+		SetConsistentRead(consistentRead).
 		SetSelect("COUNT")
-	countResult, err := dod.Client.Scan(countScan)
+	if indexName != "" {
+		countScan = countScan.SetIndexName(indexName)
+	}
+	if filterExpression != "" {
+		countScan = countScan.SetFilterExpression(filterExpression).SetExpressionAttributeNames(attrNames)
+	}
+	// DynamoDB rejects empty expression attribute values, as a filter such as attribute_not_exists needs none.
+	if len(paramValues) > 0 {
+		countScan = countScan.SetExpressionAttributeValues(paramValues)
+	}
+	totalSize, err := dod.totalSize(totalMode, indexName, signature, func() (int64, error) {
+		count := int64(0)
+		err := dod.scanPages(OperationCountScan, countScan, func(result *dynamodb.ScanOutput, lastPage bool) bool {
+			count += *result.Count
+			return true
+		})
+		return count, err
+	})
 	if err != nil {
 		return nil, err
 	}
 	scan := new(dynamodb.ScanInput).
 		SetTableName(dod.TableName).
-		SetIndexName(indexName).
-		SetConsistentRead(false).
+		SetConsistentRead(consistentRead).
 		SetLimit(pageSize)
+	if indexName != "" {
+		scan = scan.SetIndexName(indexName)
+	}
+	keyAttrs := dod.indexKeyAttrNames(indexName)
+	// The projection's aliases must not leak into the count scan's names, DynamoDB rejects unused names.
+	scanAttrNames := copyAttrNames(attrNames)
+	projection, err := dod.projectionExpression(ro, keyAttrs, scanAttrNames)
+	if err != nil {
+		return nil, err
+	}
+	if projection != "" {
+		scan = scan.SetProjectionExpression(projection)
+	}
+	if filterExpression != "" {
+		scan = scan.SetFilterExpression(filterExpression)
+	}
+	if len(paramValues) > 0 {
+		scan = scan.SetExpressionAttributeValues(paramValues)
+	}
+	if len(scanAttrNames) > 0 {
+		scan = scan.SetExpressionAttributeNames(scanAttrNames)
+	}
+	firstItemToProcess := int64(0)
+	lastItemKey, err := dod.tokenToKey(binding, lastItemToken)
+	if err != nil {
+		return nil, err
+	}
+	if lastItemKey != nil {
+		scan.SetExclusiveStartKey(lastItemKey)
+	} else {
+		firstItemToProcess = pageSize * pageOffset
+	}
 	itemIndex := int64(0)
-	firstItemToProcess := pageSize * pageOffset
 	page := &SearchPage{
-		PageSize: pageSize, PageOffset: pageOffset, TotalSize: int64(*countResult.Count),
+		PageSize: pageSize, PageOffset: pageOffset, TotalSize: totalSize,
 		Data: make([]interface{}, 0, pageSize),
 	}
 	// Don't run the scan if it cannot possibly bare fruit.
-	if firstItemToProcess >= *countResult.Count {
+	if totalMode == TotalExact && firstItemToProcess >= totalSize {
 		return page, nil
 	}
-	err = dod.Client.ScanPages(scan, func(result *dynamodb.ScanOutput, lastPage bool) bool {
+	var itemErr error
+	err = dod.scanPages(OperationScan, scan, func(result *dynamodb.ScanOutput, lastPage bool) bool {
 		for _, item := range result.Items {
 			if itemIndex >= firstItemToProcess {
-				ptrT, err := dod.UnmarshalAttributes(item)
-				if err != nil {
+				var ptrT interface{}
+				ptrT, itemErr = dod.unmarshalProjection(ro, item)
+				if itemErr != nil {
 					return false
 				}
 				page.Data = append(page.Data, ptrT)
 				if int64(len(page.Data)) >= pageSize {
 					keyAttrValues := make(map[string]*dynamodb.AttributeValue)
-					for _, name := range dod.keyAttrNames {
+					for _, name := range keyAttrs {
 						keyAttrValues[name] = item[name]
 					}
-					page.LastItemToken, err = keyToToken(keyAttrValues)
+					page.LastItemToken, itemErr = dod.keyToToken(binding, keyAttrValues)
 
 					return false
 				}
@@ -49,5 +136,8 @@ func (dod *DynamoDBDao) PagedScan(indexName string, pageOffset, pageSize int64)
 		}
 		return !lastPage && int64(len(page.Data)) < pageSize
 	})
+	if err == nil {
+		err = itemErr
+	}
 	return page, err
 }
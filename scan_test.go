@@ -76,3 +76,16 @@ func resetAndFillTable(t *testing.T) *TestStructDao {
 	require.NoError(t, err)
 	return dao
 }
+
+func TestDynamoDBDao_PagedScanWithoutTotal(t *testing.T) {
+	dao := resetAndFillTable(t)
+
+	searchPage, err := dao.dao.PagedScan("Foo", 0, 2, TotalSizeMode(TotalNone))
+	require.NoError(t, err)
+	assert.EqualValues(t, int64(-1), searchPage.TotalSize)
+	assert.EqualValues(t, int(2), len(searchPage.Data))
+
+	searchPage, err = dao.dao.PagedScan("Foo", 0, 2, TotalSizeMode(TotalApproximate))
+	require.NoError(t, err)
+	assert.EqualValues(t, int(2), len(searchPage.Data))
+}
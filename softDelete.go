@@ -0,0 +1,253 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const deletedAtTag = "dynamoDeletedAt"
+
+// The field of the DAO's type, or a type registered with it, stamped with the time its item was deleted, e.g.
+//
+//	DeletedAt *time.Time `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+//
+// An item is deleted if it has the field's attribute, which is only written when the field is set.
+type deletedAtField struct {
+	field    reflect.StructField
+	attrName string
+}
+
+// Returns the field of the struct type tagged with dynamoDeletedAt, nil if there isn't one.
+func deletedAtFieldFor(structType reflect.Type) (*deletedAtField, error) {
+	var deletedAt *deletedAtField
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		if _, ok := field.Tag.Lookup(deletedAtTag); !ok {
+			continue
+		}
+		if deletedAt != nil {
+			return nil, fmt.Errorf("%s has more than one %s field: %s and %s", structType, deletedAtTag,
+				deletedAt.field.Name, field.Name)
+		}
+		attrName := getFieldName("", field)
+		timeType := reflect.TypeOf(time.Time{})
+		if (field.Type != timeType && field.Type != reflect.PtrTo(timeType)) || attrName == "-" {
+			return nil, fmt.Errorf("the %s field %s of %s must be a stored time.Time or *time.Time", deletedAtTag,
+				field.Name, structType)
+		}
+		deletedAt = &deletedAtField{field: field, attrName: attrName}
+	}
+	return deletedAt, nil
+}
+
+// IncludeDeleted includes the items that have been soft deleted (see DeleteItem) in the results of GetItem,
+// PagedQuery, PagedScan and the aggregations, which otherwise leave them out.
+func IncludeDeleted() ReadOption {
+	return func(ro *readOptions) {
+		ro.includeDeleted = true
+	}
+}
+
+// Returns whether the read leaves soft deleted items out.
+func (dao *DynamoDBDao) excludesDeleted(ro *readOptions) bool {
+	return dao.deletedAt != nil && !ro.includeDeleted
+}
+
+// Adds the condition that items are not soft deleted to the filter expression, unless the read includes them.
+func (dao *DynamoDBDao) excludeDeleted(ro *readOptions, filterExpression string) string {
+	if !dao.excludesDeleted(ro) {
+		return filterExpression
+	}
+	notDeleted := "attribute_not_exists({" + dao.deletedAt.field.Name + "})"
+	if filterExpression == "" {
+		return notDeleted
+	}
+	return "(" + filterExpression + ") and " + notDeleted
+}
+
+// Returns whether the item has been soft deleted.
+func (dao *DynamoDBDao) isDeleted(item map[string]*dynamodb.AttributeValue) bool {
+	if dao.deletedAt == nil {
+		return false
+	}
+	_, ok := item[dao.deletedAt.attrName]
+	return ok
+}
+
+// Returns the dynamoDeletedAt field of the DAO's type or of a type registered with it, nil if it has none.
+func (dao *DynamoDBDao) deletedAtFieldOf(structType reflect.Type) *deletedAtField {
+	if structType == dao.structType {
+		return dao.deletedAt
+	}
+	if rt := dao.registeredType(structType); rt != nil {
+		return rt.deletedAt
+	}
+	return nil
+}
+
+// Removes the attribute of an item that has not been deleted, so that only deleted items have it.
+func (dao *DynamoDBDao) omitDeletedAt(item interface{}, attrVals map[string]*dynamodb.AttributeValue) {
+	value, _, ok := dao.structValue(item)
+	if !ok {
+		return
+	}
+	if deletedAt := dao.deletedAtFieldOf(value.Type()); deletedAt != nil &&
+		value.FieldByIndex(deletedAt.field.Index).IsZero() {
+		delete(attrVals, deletedAt.attrName)
+	}
+}
+
+// Returns the discriminators of the registered types that have no dynamoDeletedAt field, whose items cannot be soft
+// deleted.
+func (dao *DynamoDBDao) hardDeletedTypes() []string {
+	discriminators := make([]string, 0)
+	for discriminator, rt := range dao.types {
+		if rt.deletedAt == nil {
+			discriminators = append(discriminators, discriminator)
+		}
+	}
+	sort.Strings(discriminators)
+	return discriminators
+}
+
+// Returns the attribute value the time is stored as, according to the tags of the field.
+func (dao *DynamoDBDao) deletedAtValue(deletedAt time.Time) (*dynamodb.AttributeValue, error) {
+	item := reflect.New(dao.structType).Elem()
+	field := item.FieldByIndex(dao.deletedAt.field.Index)
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.ValueOf(&deletedAt))
+	} else {
+		field.Set(reflect.ValueOf(deletedAt))
+	}
+	attrVals, err := dynamodbattribute.MarshalMap(item.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return attrVals[dao.deletedAt.attrName], nil
+}
+
+// Marks the item with the key as deleted by stamping its dynamoDeletedAt attribute with the current time, returning
+// the item as it was before or nil if there isn't one or it was already deleted.  Whether the item can be soft deleted
+// is decided by the type it is stored as: an item of a registered type without a dynamoDeletedAt field is deleted for
+// good instead.
+func (dao *DynamoDBDao) softDelete(key interface{}) (interface{}, error) {
+	if err := beforeDelete(hookTarget(key)); err != nil {
+		return nil, err
+	}
+	keyAttrs, err := dao.MarshalKey(key)
+	if err != nil {
+		dao.log(LogError, "marshal key failed", LogField{Key: "op", Value: OperationDeleteItem},
+			LogField{Key: "error", Value: err})
+		return nil, err
+	}
+	deletedAt, err := dao.deletedAtValue(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	attrNames := map[string]*string{"#d": aws.String(dao.deletedAt.attrName)}
+	attrValues := map[string]*dynamodb.AttributeValue{":d": deletedAt}
+	condition := "attribute_not_exists(#d)"
+	if len(dao.keyAttrNames) > 0 {
+		attrNames["#k"] = aws.String(dao.keyAttrNames[0])
+		condition = "attribute_exists(#k) and " + condition
+	}
+	// Items of the types that cannot be soft deleted are left alone by the update and deleted by the fallback.
+	hardDeleted := dao.hardDeletedTypes()
+	var typeNames map[string]*string
+	var typeValues map[string]*dynamodb.AttributeValue
+	var typeCondition string
+	if len(hardDeleted) > 0 {
+		typeNames = map[string]*string{"#t": aws.String(dao.typeAttribute)}
+		typeValues = make(map[string]*dynamodb.AttributeValue, len(hardDeleted))
+		placeholders := make([]string, len(hardDeleted))
+		for i, discriminator := range hardDeleted {
+			placeholders[i] = ":t" + strconv.Itoa(i)
+			typeValues[placeholders[i]] = new(dynamodb.AttributeValue).SetS(discriminator)
+		}
+		typeCondition = "#t IN (" + strings.Join(placeholders, ", ") + ")"
+		attrNames["#t"] = typeNames["#t"]
+		condition += " and NOT (" + typeCondition + ")"
+		for placeholder, value := range typeValues {
+			attrValues[placeholder] = value
+		}
+	}
+	updateItem := new(dynamodb.UpdateItemInput).SetTableName(dao.TableName).SetKey(keyAttrs).
+		SetUpdateExpression("SET #d = :d").SetConditionExpression(condition).
+		SetExpressionAttributeNames(attrNames).SetExpressionAttributeValues(attrValues).
+		SetReturnValues(dynamodb.ReturnValueAllOld)
+
+	output, err := dao.send(OperationUpdateItem, "", updateItem, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.UpdateItemWithContext(aws.BackgroundContext(), updateItem, reqOpts...)
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		if typeCondition == "" {
+			return nil, nil
+		}
+		deleteItem := new(dynamodb.DeleteItemInput).SetTableName(dao.TableName).SetKey(keyAttrs).
+			SetConditionExpression(typeCondition).SetExpressionAttributeNames(typeNames).
+			SetExpressionAttributeValues(typeValues).SetReturnValues(dynamodb.ReturnValueAllOld)
+		item, err := dao.deleteItem(keyAttrs, deleteItem)
+		if errors.Is(err, ErrConditionFailed) {
+			return nil, nil
+		}
+		return item, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	dao.cacheItem(keyAttrs, nil)
+	return dao.unmarshalReturned(OperationDeleteItem, output.(*dynamodb.UpdateItemOutput).Attributes)
+}
+
+// Undoes the soft delete (see DeleteItem) of the item with the given key, returning the item restored or nil if there
+// isn't a deleted item with the key.
+func (dao *DynamoDBDao) Restore(key interface{}) (interface{}, error) {
+	if dao.deletedAt == nil {
+		return nil, fmt.Errorf("cannot restore items of %s: it has no %s field", dao.structType, deletedAtTag)
+	}
+	keyAttrs, err := dao.MarshalKey(key)
+	if err != nil {
+		return nil, err
+	}
+	updateItem := new(dynamodb.UpdateItemInput).SetTableName(dao.TableName).SetKey(keyAttrs).
+		SetUpdateExpression("REMOVE #d").SetConditionExpression("attribute_exists(#d)").
+		SetExpressionAttributeNames(map[string]*string{"#d": aws.String(dao.deletedAt.attrName)}).
+		SetReturnValues(dynamodb.ReturnValueAllNew)
+
+	output, err := dao.send(OperationUpdateItem, "", updateItem, func(reqOpts ...request.Option) (interface{}, error) {
+		return dao.Client.UpdateItemWithContext(aws.BackgroundContext(), updateItem, reqOpts...)
+	})
+	if errors.Is(err, ErrConditionFailed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	attributes := output.(*dynamodb.UpdateItemOutput).Attributes
+	dao.cacheItem(keyAttrs, attributes)
+	return dao.unmarshalReturned(OperationUpdateItem, attributes)
+}
+
+// Unmarshals the attributes returned by an update or delete, nil if there are none.
+func (dao *DynamoDBDao) unmarshalReturned(operation string,
+	attributes map[string]*dynamodb.AttributeValue) (interface{}, error) {
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+	ptrT, err := dao.UnmarshalAttributes(attributes)
+	if err != nil {
+		dao.log(LogError, "unmarshal failed", LogField{Key: "op", Value: operation},
+			LogField{Key: "error", Value: err})
+		return nil, err
+	}
+	return ptrT, nil
+}
@@ -0,0 +1,206 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type Account struct {
+	Id        string     `dynamodbav:"id" dynamoKey:"hash"`
+	Name      string     `dynamodbav:"name"`
+	DeletedAt *time.Time `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+}
+
+type SoftUser struct {
+	Kind      string     `dynamodbav:"type" dynamoType:"USER"`
+	Id        string     `dynamodbav:"id" dynamoKey:"hash"`
+	DeletedAt *time.Time `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+}
+
+type SoftGroup struct {
+	Kind      string    `dynamodbav:"type" dynamoType:"GROUP"`
+	Id        string    `dynamodbav:"id" dynamoKey:"hash"`
+	DeletedAt time.Time `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+}
+
+// Sessions cannot be soft deleted.
+type SoftSession struct {
+	Kind  string `dynamodbav:"type" dynamoType:"SESSION"`
+	Id    string `dynamodbav:"id" dynamoKey:"hash"`
+	Token string `dynamodbav:"token"`
+}
+
+type SoftMisnamed struct {
+	Kind      string     `dynamodbav:"type" dynamoType:"MISNAMED"`
+	Id        string     `dynamodbav:"id" dynamoKey:"hash"`
+	RemovedAt *time.Time `dynamodbav:"removed_at" dynamoDeletedAt:""`
+}
+
+func newAccountDao(t *testing.T) (*DynamoDBDao, *requestRecorder) {
+	dao := newTestDao(t, "Account", reflect.TypeOf(Account{}))
+	fake := new(requestRecorder)
+	dao.SetLogger(nil).AddInterceptors(fake.intercept)
+	return dao, fake
+}
+
+func TestSoftDeleteMarshal(t *testing.T) {
+	dao, _ := newAccountDao(t)
+	attrVals, err := dao.MarshalAttributes(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.NotContains(t, attrVals, "deleted_at")
+	deletedAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	attrVals, err = dao.MarshalAttributes(&Account{Id: "1", DeletedAt: &deletedAt})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-01T00:00:00Z", *attrVals["deleted_at"].S)
+
+	type Plain struct {
+		Id        string `dynamodbav:"id" dynamoKey:"hash"`
+		DeletedAt string `dynamodbav:"deleted_at" dynamoDeletedAt:""`
+	}
+	_, err = NewDynamoDBDao(session.New(awsConfig), "Plain", 0, 0, false, "", reflect.TypeOf(Plain{}))
+	assert.EqualError(t, err,
+		"the dynamoDeletedAt field DeletedAt of dynamoDao.Plain must be a stored time.Time or *time.Time")
+}
+
+func TestSoftDeleteItem(t *testing.T) {
+	dao, fake := newAccountDao(t)
+	fake.item = map[string]*dynamodb.AttributeValue{
+		"id":   new(dynamodb.AttributeValue).SetS("1"),
+		"name": new(dynamodb.AttributeValue).SetS("Joe"),
+	}
+	before := time.Now()
+	item, err := dao.DeleteItem(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Account{Id: "1", Name: "Joe"}, item)
+	update := fake.inputs[0].(*dynamodb.UpdateItemInput)
+	assert.Equal(t, "SET #d = :d", *update.UpdateExpression)
+	assert.Equal(t, "attribute_exists(#k) and attribute_not_exists(#d)", *update.ConditionExpression)
+	assert.Equal(t, "deleted_at", *update.ExpressionAttributeNames["#d"])
+	assert.Equal(t, "id", *update.ExpressionAttributeNames["#k"])
+	deletedAt, err := time.Parse(time.RFC3339Nano, *update.ExpressionAttributeValues[":d"].S)
+	require.NoError(t, err)
+	assert.False(t, deletedAt.Before(before.Truncate(time.Second)))
+
+	// Deleting an item that isn't there, or is already deleted, returns nil.
+	fake.conditionFailed = true
+	item, err = dao.DeleteItem(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.Nil(t, item)
+	item, err = dao.Restore(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.Nil(t, item)
+
+	fake.conditionFailed = false
+	item, err = dao.Restore(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Account{Id: "1", Name: "Joe"}, item)
+	restore := fake.inputs[3].(*dynamodb.UpdateItemInput)
+	assert.Equal(t, "REMOVE #d", *restore.UpdateExpression)
+	assert.Equal(t, "attribute_exists(#d)", *restore.ConditionExpression)
+	assert.Equal(t, dynamodb.ReturnValueAllNew, *restore.ReturnValues)
+
+	item, err = dao.Purge(&Account{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, &Account{Id: "1", Name: "Joe"}, item)
+	assert.IsType(t, &dynamodb.DeleteItemInput{}, fake.inputs[4])
+
+	_, err = newTestDao(t, "Struct3", reflect.TypeOf(Struct3{})).Restore(&Struct3{OrgId: "org", Id: "1"})
+	assert.EqualError(t, err, "cannot restore items of dynamoDao.Struct3: it has no dynamoDeletedAt field")
+}
+
+func TestSoftDeleteReads(t *testing.T) {
+	dao, fake := newAccountDao(t)
+	dao.SetNotFoundError(true)
+	fake.item = map[string]*dynamodb.AttributeValue{
+		"id":         new(dynamodb.AttributeValue).SetS("1"),
+		"deleted_at": new(dynamodb.AttributeValue).SetS("2024-03-01T00:00:00Z"),
+	}
+	_, err := dao.GetItem(&Account{Id: "1"})
+	assert.EqualError(t, err, "GetItem Account: item not found")
+	item, err := dao.GetItem(&Account{Id: "1"}, IncludeDeleted())
+	require.NoError(t, err)
+	assert.Equal(t, "2024-03-01T00:00:00Z", item.(*Account).DeletedAt.Format(time.RFC3339))
+
+	// The attribute is read even when it isn't projected, so that deleted items can be left out.
+	_, err = dao.GetItem(&Account{Id: "1"}, ProjectFields("Name"))
+	assert.Error(t, err)
+	get := fake.inputs[2].(*dynamodb.GetItemInput)
+	assert.Equal(t, "#A, #B", *get.ProjectionExpression)
+	assert.Equal(t, "deleted_at", *get.ExpressionAttributeNames["#A"])
+
+	fake.inputs = nil
+	queryValues := map[string]interface{}{":i": "1", ":n": "Joe"}
+	_, err = dao.PagedQuery("", "{Id} = :i", "{Name} = :n", queryValues, nil, 0, 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, fake.inputs)
+	for _, input := range fake.inputs {
+		query := input.(*dynamodb.QueryInput)
+		assert.Equal(t, "(#B = :n) and attribute_not_exists(#C)", *query.FilterExpression)
+		assert.Equal(t, "deleted_at", *query.ExpressionAttributeNames["#C"])
+	}
+	fake.inputs = nil
+	_, err = dao.PagedScan("", 0, 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, fake.inputs)
+	for _, input := range fake.inputs {
+		scan := input.(*dynamodb.ScanInput)
+		assert.Equal(t, "attribute_not_exists(#A)", *scan.FilterExpression)
+		assert.Equal(t, "deleted_at", *scan.ExpressionAttributeNames["#A"])
+		assert.Nil(t, scan.ExpressionAttributeValues)
+	}
+	fake.inputs = nil
+	_, err = dao.PagedScan("", 0, 10, IncludeDeleted())
+	require.NoError(t, err)
+	for _, input := range fake.inputs {
+		assert.Nil(t, input.(*dynamodb.ScanInput).FilterExpression)
+	}
+}
+
+func TestSoftDeleteRegisteredTypes(t *testing.T) {
+	dao := newTestDao(t, "Soft", reflect.TypeOf(SoftUser{}))
+	require.NoError(t, dao.RegisterType(reflect.TypeOf(SoftGroup{}), ""))
+	require.NoError(t, dao.RegisterType(reflect.TypeOf(SoftSession{}), ""))
+	assert.EqualError(t, dao.RegisterType(reflect.TypeOf(SoftMisnamed{}), ""),
+		"cannot register dynamoDao.SoftMisnamed: its dynamoDeletedAt attribute removed_at is not that of "+
+			"dynamoDao.SoftUser")
+	recorder := new(requestRecorder)
+	dao.SetLogger(nil).AddInterceptors(recorder.intercept)
+
+	attrVals, err := dao.MarshalAttributes(&SoftGroup{Id: "g"})
+	require.NoError(t, err)
+	assert.NotContains(t, attrVals, "deleted_at")
+
+	// The update only stamps items of the types that can be soft deleted.
+	recorder.item = map[string]*dynamodb.AttributeValue{
+		"type": new(dynamodb.AttributeValue).SetS("GROUP"),
+		"id":   new(dynamodb.AttributeValue).SetS("g"),
+	}
+	item, err := dao.DeleteItem(&SoftGroup{Id: "g"})
+	require.NoError(t, err)
+	assert.Equal(t, &SoftGroup{Kind: "GROUP", Id: "g"}, item)
+	update := recorder.inputs[0].(*dynamodb.UpdateItemInput)
+	assert.Equal(t, "attribute_exists(#k) and attribute_not_exists(#d) and NOT (#t IN (:t0))",
+		*update.ConditionExpression)
+	assert.Equal(t, "type", *update.ExpressionAttributeNames["#t"])
+	assert.Equal(t, "SESSION", *update.ExpressionAttributeValues[":t0"].S)
+
+	// Items of the other types fail the update's condition and are deleted for good.
+	recorder.conditionFailed = true
+	recorder.item = map[string]*dynamodb.AttributeValue{
+		"type":  new(dynamodb.AttributeValue).SetS("SESSION"),
+		"id":    new(dynamodb.AttributeValue).SetS("s"),
+		"token": new(dynamodb.AttributeValue).SetS("secret"),
+	}
+	item, err = dao.DeleteItem(&SoftSession{Id: "s"})
+	require.NoError(t, err)
+	assert.Equal(t, &SoftSession{Kind: "SESSION", Id: "s", Token: "secret"}, item)
+	require.Equal(t, 3, len(recorder.inputs))
+	deleteItem := recorder.inputs[2].(*dynamodb.DeleteItemInput)
+	assert.Equal(t, "#t IN (:t0)", *deleteItem.ConditionExpression)
+	assert.Equal(t, "SESSION", *deleteItem.ExpressionAttributeValues[":t0"].S)
+}
@@ -0,0 +1,523 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Statement is a SELECT statement compiled by Prepare into a query, or a scan, of the DAO's table or one of its
+// indexes.  The grammar is (keywords are case insensitive):
+//
+//	SELECT * | path [, path]... FROM table [USE INDEX index]
+//		[WHERE condition [AND condition]...] [LIMIT pageSize] [ALLOW SCAN]
+//
+//	condition := path = value | path <> value | path != value | path < value | path <= value
+//		| path > value | path >= value | path BETWEEN value AND value | path BEGINS_WITH value
+//		| path CONTAINS value | path IN (value [, value]...) | path EXISTS | path NOT EXISTS
+//	value := ? | 'string' | number | TRUE | FALSE
+//
+// A path is a Go field or attribute path as accepted by PagedQuery (e.g. phone_number, Address.City or Tags[0]), and
+// may be surrounded by {} if it is also a keyword.  The ? parameters are replaced by the arguments given to Execute in
+// order.  For example:
+//
+//	SELECT name, phone_number FROM Struct1 USE INDEX PhoneNumberIdx
+//		WHERE organization_id = ? AND phone_number BEGINS_WITH ? LIMIT 20
+//
+// The equality condition on the hash key, and the first key condition on the range key, of the index become the key
+// condition of the query, and the remaining conditions its filter.  Without USE INDEX the table or index is picked the
+// same way FindBy picks one.  If no table or index can be queried, the statement is run as a scan, but only if it ends
+// with ALLOW SCAN or the AllowScan option is given to Execute.  The selected paths are read with the ProjectFields
+// option, LIMIT sets the page size (the default is 50).
+type Statement struct {
+	dao        *DynamoDBDao
+	fields     []string
+	indexName  string
+	conditions []statementCondition
+	hashKey    int
+	rangeKey   int
+	scan       bool
+	allowScan  bool
+	params     int
+	pageSize   int64
+}
+
+// A condition of the WHERE clause.  The operator is one of =, <>, <, <=, >, >=, BETWEEN, BEGINS_WITH, CONTAINS, IN,
+// EXISTS, or NOT EXISTS.
+type statementCondition struct {
+	attrPath string
+	operator string
+	values   []statementValue
+}
+
+// A value in a condition, either a literal or the index of the ? parameter whose argument is used.
+type statementValue struct {
+	param   int
+	literal interface{}
+}
+
+type statementTokenKind int
+
+const (
+	statementWord statementTokenKind = iota
+	statementString
+	statementNumber
+	statementParam
+	statementSymbol
+	statementEnd
+)
+
+type statementToken struct {
+	kind statementTokenKind
+	text string
+	pos  int
+}
+
+var (
+	statementWordRegex = regexp.MustCompile(
+		"^(\\{[^}]+\\}|[A-Za-z_][A-Za-z0-9_\\-]*)(\\[\\d+\\])*(\\.(\\{[^}]+\\}|[A-Za-z_][A-Za-z0-9_\\-]*)(\\[\\d+\\])*)*")
+	statementNumberRegex = regexp.MustCompile("^-?\\d+(\\.\\d+)?([eE][-+]?\\d+)?")
+	statementSymbols     = []string{"<=", ">=", "<>", "!=", "=", "<", ">", ",", "(", ")", "*"}
+)
+
+var comparisonOperators = map[string]bool{"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// The operators that may be used in the key condition of a query on the range key.
+var rangeKeyOperators = map[string]bool{
+	"=": true, "<": true, "<=": true, ">": true, ">=": true, "BETWEEN": true, "BEGINS_WITH": true,
+}
+
+// Parses the statement and plans how it is run.  The FROM clause must name the DAO's table and every path must be an
+// attribute of the DAO's struct type.
+func (dao *DynamoDBDao) Prepare(statement string) (*Statement, error) {
+	tokens, err := lexStatement(statement)
+	if err != nil {
+		return nil, err
+	}
+	parser := &statementParser{tokens: tokens}
+	st, err := parser.parse(dao)
+	if err != nil {
+		return nil, err
+	}
+	if err := st.plan(); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Prepares and executes the statement.
+func (dao *DynamoDBDao) Select(statement string, args []interface{}, lastItemToken *string, pageOffset int64,
+	opts ...ReadOption) (*SearchPage, error) {
+	st, err := dao.Prepare(statement)
+	if err != nil {
+		return nil, err
+	}
+	return st.Execute(args, lastItemToken, pageOffset, opts...)
+}
+
+// Runs the statement with the given arguments for its ? parameters, returning the requested page.  The lastItemToken
+// and pageOffset are handled as in PagedQuery.
+func (st *Statement) Execute(args []interface{}, lastItemToken *string, pageOffset int64,
+	opts ...ReadOption) (*SearchPage, error) {
+	qb, err := st.bind(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(st.fields) > 0 {
+		opts = append([]ReadOption{ProjectFields(st.fields...)}, opts...)
+	}
+	if st.scan {
+		if !st.allowScan && !newReadOptions(opts).allowScan {
+			return nil, errors.New("statement: no table or index key matches the conditions, add ALLOW SCAN to scan")
+		}
+		return st.dao.pagedScan(st.indexName, strings.Join(qb.filterConditions, " and "), qb.queryValues,
+			lastItemToken, pageOffset, st.pageSize, opts...)
+	}
+	return qb.StartAfter(lastItemToken).Offset(pageOffset).Limit(st.pageSize).Options(opts...).Execute()
+}
+
+// Picks the table or index to query, and the conditions forming its key condition, or decides the statement needs a
+// scan.
+func (st *Statement) plan() error {
+	hashConditions := make(map[string]interface{})
+	rangeConditions := make(map[string]interface{})
+	for _, condition := range st.conditions {
+		if condition.operator == "=" {
+			hashConditions[condition.attrPath] = nil
+		}
+		if rangeKeyOperators[condition.operator] {
+			rangeConditions[condition.attrPath] = nil
+		}
+	}
+	var candidate *findByCandidate
+	if st.indexName != "" {
+		keySchema, err := st.dao.indexKeySchema(st.indexName)
+		if err != nil {
+			return errors.New("statement: " + err.Error())
+		}
+		candidate = st.dao.indexCandidate(st.indexName, keySchema, hashConditions, rangeConditions)
+	} else {
+		candidate = st.dao.bestIndexForKeys(hashConditions, rangeConditions)
+	}
+	if candidate == nil || candidate.score == 0 {
+		st.scan = true
+		return nil
+	}
+	st.indexName = candidate.indexName
+	st.hashKey, st.rangeKey = -1, -1
+	for i, condition := range st.conditions {
+		switch {
+		case condition.attrPath == candidate.hashKey && condition.operator == "=" && st.hashKey < 0:
+			st.hashKey = i
+		case condition.attrPath == candidate.rangeKey && rangeKeyOperators[condition.operator] && st.rangeKey < 0:
+			st.rangeKey = i
+		case condition.attrPath == candidate.hashKey || condition.attrPath == candidate.rangeKey:
+			return fmt.Errorf("statement: %s is a key of %s and only one = condition on the hash key or key "+
+				"condition on the range key can be used", condition.attrPath, st.indexDescription())
+		}
+	}
+	return nil
+}
+
+func (st *Statement) indexDescription() string {
+	if st.indexName == "" {
+		return "table " + st.dao.TableName
+	}
+	return "index " + st.indexName
+}
+
+// Builds the query (or, for a scan, the filter) with the arguments in place of the ? parameters.
+func (st *Statement) bind(args []interface{}) (*QueryBuilder, error) {
+	if len(args) != st.params {
+		return nil, fmt.Errorf("statement: %d arguments given for %d parameters", len(args), st.params)
+	}
+	qb := st.dao.Query().Index(st.indexName)
+	for i, condition := range st.conditions {
+		values := make([]interface{}, len(condition.values))
+		for v, value := range condition.values {
+			if value.param >= 0 {
+				values[v] = args[value.param]
+			} else {
+				values[v] = value.literal
+			}
+		}
+		switch {
+		case !st.scan && i == st.hashKey:
+			qb.Key(condition.attrPath).Eq(values[0])
+		case !st.scan && i == st.rangeKey:
+			rangeCondition := qb.Range(condition.attrPath)
+			switch condition.operator {
+			case "=":
+				rangeCondition.Eq(values[0])
+			case "<":
+				rangeCondition.Lt(values[0])
+			case "<=":
+				rangeCondition.Le(values[0])
+			case ">":
+				rangeCondition.Gt(values[0])
+			case ">=":
+				rangeCondition.Ge(values[0])
+			case "BETWEEN":
+				rangeCondition.Between(values[0], values[1])
+			case "BEGINS_WITH":
+				rangeCondition.BeginsWith(values[0])
+			}
+		default:
+			filterCondition := qb.Filter(condition.attrPath)
+			switch condition.operator {
+			case "=":
+				filterCondition.Eq(values[0])
+			case "<>":
+				filterCondition.Ne(values[0])
+			case "<":
+				filterCondition.Lt(values[0])
+			case "<=":
+				filterCondition.Le(values[0])
+			case ">":
+				filterCondition.Gt(values[0])
+			case ">=":
+				filterCondition.Ge(values[0])
+			case "BETWEEN":
+				filterCondition.Between(values[0], values[1])
+			case "BEGINS_WITH":
+				filterCondition.BeginsWith(values[0])
+			case "CONTAINS":
+				filterCondition.Contains(values[0])
+			case "IN":
+				filterCondition.In(values...)
+			case "EXISTS":
+				filterCondition.Exists()
+			case "NOT EXISTS":
+				filterCondition.NotExists()
+			}
+		}
+	}
+	if qb.err != nil {
+		return nil, qb.err
+	}
+	return qb, nil
+}
+
+// Splits the statement into words (keywords and paths), strings, numbers, ? parameters and symbols.
+func lexStatement(statement string) ([]statementToken, error) {
+	tokens := make([]statementToken, 0, 16)
+	for pos := 0; ; {
+		for pos < len(statement) && strings.ContainsRune(" \t\r\n", rune(statement[pos])) {
+			pos++
+		}
+		if pos == len(statement) {
+			return append(tokens, statementToken{kind: statementEnd, pos: pos}), nil
+		}
+		rest := statement[pos:]
+		token := statementToken{pos: pos}
+		switch {
+		case rest[0] == '?':
+			token.kind, token.text = statementParam, "?"
+		case rest[0] == '\'':
+			end := 1
+			for ; end < len(rest); end++ {
+				if rest[end] == '\'' {
+					if end+1 < len(rest) && rest[end+1] == '\'' {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			if end == len(rest) {
+				return nil, fmt.Errorf("statement: unterminated string at position %d", pos)
+			}
+			token.kind, token.text = statementString, rest[:end+1]
+		case statementNumberRegex.MatchString(rest):
+			token.kind, token.text = statementNumber, statementNumberRegex.FindString(rest)
+		case statementWordRegex.MatchString(rest):
+			token.kind, token.text = statementWord, statementWordRegex.FindString(rest)
+		default:
+			for _, symbol := range statementSymbols {
+				if strings.HasPrefix(rest, symbol) {
+					token.kind, token.text = statementSymbol, symbol
+					break
+				}
+			}
+			if token.text == "" {
+				return nil, fmt.Errorf("statement: unexpected character %q at position %d", rest[0], pos)
+			}
+		}
+		tokens = append(tokens, token)
+		pos += len(token.text)
+	}
+}
+
+type statementParser struct {
+	tokens []statementToken
+	pos    int
+	params int
+}
+
+func (p *statementParser) parse(dao *DynamoDBDao) (*Statement, error) {
+	st := &Statement{dao: dao, pageSize: defaultQueryPageSize, hashKey: -1, rangeKey: -1}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	if p.isSymbol("*") {
+		p.pos++
+	} else {
+		for {
+			attrPath, err := p.path(dao)
+			if err != nil {
+				return nil, err
+			}
+			st.fields = append(st.fields, attrPath)
+			if !p.isSymbol(",") {
+				break
+			}
+			p.pos++
+		}
+	}
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table := p.next()
+	if table.kind != statementWord || table.text != dao.TableName {
+		return nil, fmt.Errorf("statement: expected the table %s at position %d", dao.TableName, table.pos)
+	}
+	if p.isKeyword("USE") {
+		p.pos++
+		if err := p.expectKeyword("INDEX"); err != nil {
+			return nil, err
+		}
+		index := p.next()
+		if index.kind != statementWord {
+			return nil, fmt.Errorf("statement: expected an index name at position %d", index.pos)
+		}
+		st.indexName = index.text
+	}
+	if p.isKeyword("WHERE") {
+		p.pos++
+		for {
+			condition, err := p.condition(dao)
+			if err != nil {
+				return nil, err
+			}
+			st.conditions = append(st.conditions, condition)
+			if p.isKeyword("OR") {
+				return nil, fmt.Errorf("statement: OR is not supported at position %d", p.tokens[p.pos].pos)
+			}
+			if !p.isKeyword("AND") {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.isKeyword("LIMIT") {
+		p.pos++
+		limit := p.next()
+		pageSize, err := strconv.ParseInt(limit.text, 10, 64)
+		if limit.kind != statementNumber || err != nil || pageSize <= 0 {
+			return nil, fmt.Errorf("statement: expected a positive whole number at position %d", limit.pos)
+		}
+		st.pageSize = pageSize
+	}
+	if p.isKeyword("ALLOW") {
+		p.pos++
+		if err := p.expectKeyword("SCAN"); err != nil {
+			return nil, err
+		}
+		st.allowScan = true
+	}
+	if end := p.next(); end.kind != statementEnd {
+		return nil, fmt.Errorf("statement: unexpected %s at position %d", end.text, end.pos)
+	}
+	st.params = p.params
+	return st, nil
+}
+
+func (p *statementParser) condition(dao *DynamoDBDao) (statementCondition, error) {
+	attrPath, err := p.path(dao)
+	if err != nil {
+		return statementCondition{}, err
+	}
+	condition := statementCondition{attrPath: attrPath}
+	operator := p.next()
+	switch {
+	case operator.kind == statementSymbol && comparisonOperators[operator.text]:
+		condition.operator = operator.text
+		if operator.text == "!=" {
+			condition.operator = "<>"
+		}
+		err = p.values(&condition, 1)
+	case operator.kind != statementWord:
+		err = fmt.Errorf("statement: expected an operator at position %d", operator.pos)
+	case strings.EqualFold(operator.text, "BETWEEN"):
+		condition.operator = "BETWEEN"
+		if err = p.values(&condition, 1); err == nil {
+			if err = p.expectKeyword("AND"); err == nil {
+				err = p.values(&condition, 1)
+			}
+		}
+	case strings.EqualFold(operator.text, "BEGINS_WITH") || strings.EqualFold(operator.text, "CONTAINS"):
+		condition.operator = strings.ToUpper(operator.text)
+		err = p.values(&condition, 1)
+	case strings.EqualFold(operator.text, "IN"):
+		condition.operator = "IN"
+		if err = p.expectSymbol("("); err != nil {
+			break
+		}
+		for {
+			if err = p.values(&condition, 1); err != nil || !p.isSymbol(",") {
+				break
+			}
+			p.pos++
+		}
+		if err == nil {
+			err = p.expectSymbol(")")
+		}
+	case strings.EqualFold(operator.text, "EXISTS"):
+		condition.operator = "EXISTS"
+	case strings.EqualFold(operator.text, "NOT"):
+		condition.operator = "NOT EXISTS"
+		err = p.expectKeyword("EXISTS")
+	default:
+		err = fmt.Errorf("statement: unknown operator %s at position %d", operator.text, operator.pos)
+	}
+	return condition, err
+}
+
+// Reads count values into the condition.
+func (p *statementParser) values(condition *statementCondition, count int) error {
+	for i := 0; i < count; i++ {
+		token := p.next()
+		value := statementValue{param: -1}
+		switch {
+		case token.kind == statementParam:
+			value.param = p.params
+			p.params++
+		case token.kind == statementString:
+			value.literal = strings.Replace(token.text[1:len(token.text)-1], "''", "'", -1)
+		case token.kind == statementNumber:
+			if n, err := strconv.ParseInt(token.text, 10, 64); err == nil {
+				value.literal = n
+			} else if f, err := strconv.ParseFloat(token.text, 64); err == nil {
+				value.literal = f
+			} else {
+				return fmt.Errorf("statement: invalid number %s at position %d", token.text, token.pos)
+			}
+		case token.kind == statementWord && (strings.EqualFold(token.text, "TRUE") ||
+			strings.EqualFold(token.text, "FALSE")):
+			value.literal = strings.EqualFold(token.text, "TRUE")
+		default:
+			return fmt.Errorf("statement: expected a value at position %d", token.pos)
+		}
+		condition.values = append(condition.values, value)
+	}
+	return nil
+}
+
+// Reads a path and resolves it to an attribute path of the DAO's struct type.
+func (p *statementParser) path(dao *DynamoDBDao) (string, error) {
+	token := p.next()
+	if token.kind != statementWord {
+		return "", fmt.Errorf("statement: expected a field or attribute at position %d", token.pos)
+	}
+	attrPath, err := dao.resolveAttributeName(strings.NewReplacer("{", "", "}", "").Replace(token.text))
+	if err != nil {
+		return "", fmt.Errorf("statement: %s at position %d", err.Error(), token.pos)
+	}
+	return attrPath, nil
+}
+
+func (p *statementParser) next() statementToken {
+	token := p.tokens[p.pos]
+	if token.kind != statementEnd {
+		p.pos++
+	}
+	return token
+}
+
+func (p *statementParser) isKeyword(keyword string) bool {
+	token := p.tokens[p.pos]
+	return token.kind == statementWord && strings.EqualFold(token.text, keyword)
+}
+
+func (p *statementParser) isSymbol(symbol string) bool {
+	token := p.tokens[p.pos]
+	return token.kind == statementSymbol && token.text == symbol
+}
+
+func (p *statementParser) expectKeyword(keyword string) error {
+	if !p.isKeyword(keyword) {
+		return fmt.Errorf("statement: expected %s at position %d", keyword, p.tokens[p.pos].pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *statementParser) expectSymbol(symbol string) error {
+	if !p.isSymbol(symbol) {
+		return fmt.Errorf("statement: expected %s at position %d", symbol, p.tokens[p.pos].pos)
+	}
+	p.pos++
+	return nil
+}
@@ -0,0 +1,121 @@
+package dynamoDao
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+func TestLexStatement(t *testing.T) {
+	tokens, err := lexStatement("SELECT {a}.b, tags[0] FROM T WHERE x >= ? AND y = 'it''s' AND z<>-1.5e3")
+	require.NoError(t, err)
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.text
+	}
+	assert.Equal(t, []string{"SELECT", "{a}.b", ",", "tags[0]", "FROM", "T", "WHERE", "x", ">=", "?", "AND", "y", "=",
+		"'it''s'", "AND", "z", "<>", "-1.5e3", ""}, texts)
+	assert.Equal(t, statementString, tokens[13].kind)
+	assert.Equal(t, statementNumber, tokens[17].kind)
+	assert.Equal(t, statementEnd, tokens[18].kind)
+
+	_, err = lexStatement("SELECT * FROM T WHERE a = 'oops")
+	assert.EqualError(t, err, "statement: unterminated string at position 26")
+	_, err = lexStatement("SELECT * FROM T WHERE a ~ ?")
+	assert.EqualError(t, err, "statement: unexpected character '~' at position 24")
+}
+
+func TestPrepareQuery(t *testing.T) {
+	dao := newTestDao(t, "Struct1", reflect.TypeOf(Struct1{}))
+
+	st, err := dao.Prepare("SELECT name, PhoneNumber FROM Struct1 USE INDEX PhoneNumberIdx " +
+		"WHERE organization_id = ? AND phone_number BEGINS_WITH ? LIMIT 20")
+	require.NoError(t, err)
+	assert.False(t, st.scan)
+	assert.Equal(t, []string{"name", "phone_number"}, st.fields)
+	assert.Equal(t, int64(20), st.pageSize)
+	qb, err := st.bind([]interface{}{"org", "555"})
+	require.NoError(t, err)
+	indexName, keyExpression, filterExpression, queryValues, err := qb.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "PhoneNumberIdx", indexName)
+	assert.Equal(t, "{organization_id} = :v0 and begins_with({phone_number}, :v1)", keyExpression)
+	assert.Equal(t, "", filterExpression)
+	assert.Equal(t, map[string]interface{}{":v0": "org", ":v1": "555"}, queryValues)
+
+	// Without USE INDEX the index is picked from the conditions, and the rest are applied as a filter.
+	st, err = dao.Prepare("select * from Struct1 where phone_number > ? and organization_id = ? " +
+		"and name in ('Joe', 'Jane') and person_id not exists")
+	require.NoError(t, err)
+	assert.Nil(t, st.fields)
+	assert.Equal(t, defaultQueryPageSize, st.pageSize)
+	qb, err = st.bind([]interface{}{"555", "org"})
+	require.NoError(t, err)
+	indexName, keyExpression, filterExpression, queryValues, err = qb.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "PhoneNumberIdx", indexName)
+	assert.Equal(t, "{phone_number} > :v0 and {organization_id} = :v1", keyExpression)
+	assert.Equal(t, "{name} in (:v2, :v3) and attribute_not_exists({person_id})", filterExpression)
+	assert.Equal(t, map[string]interface{}{":v0": "555", ":v1": "org", ":v2": "Joe", ":v3": "Jane"}, queryValues)
+
+	_, err = st.bind([]interface{}{"555"})
+	assert.EqualError(t, err, "statement: 1 arguments given for 2 parameters")
+}
+
+func TestPrepareLiterals(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	st, err := dao.Prepare("SELECT * FROM TestStruct WHERE a = 'x' AND B BETWEEN 1 AND ? AND D = TRUE AND c < 2.5 " +
+		"AND F.G CONTAINS 'y' AND n EXISTS AND n != ''")
+	require.NoError(t, err)
+	qb, err := st.bind([]interface{}{10})
+	require.NoError(t, err)
+	indexName, keyExpression, filterExpression, queryValues, err := qb.Build()
+	require.NoError(t, err)
+	assert.Equal(t, "", indexName)
+	assert.Equal(t, "{a} = :v0 and {B} between :v1 and :v2", keyExpression)
+	assert.Equal(t, "{D} = :v3 and {c} < :v4 and contains({f}.{G}, :v5) and attribute_exists({n}) and {n} <> :v6",
+		filterExpression)
+	assert.Equal(t, map[string]interface{}{":v0": "x", ":v1": int64(1), ":v2": 10, ":v3": true, ":v4": 2.5,
+		":v5": "y", ":v6": ""}, queryValues)
+}
+
+func TestPrepareScan(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	st, err := dao.Prepare("SELECT n FROM TestStruct WHERE n = ? AND c > ?")
+	require.NoError(t, err)
+	assert.True(t, st.scan)
+	_, err = st.Execute([]interface{}{"bar", 1}, nil, 0)
+	assert.EqualError(t, err, "statement: no table or index key matches the conditions, add ALLOW SCAN to scan")
+
+	st, err = dao.Prepare("SELECT n FROM TestStruct WHERE n = ? AND c > ? ALLOW SCAN")
+	require.NoError(t, err)
+	assert.True(t, st.scan)
+	assert.True(t, st.allowScan)
+	qb, err := st.bind([]interface{}{"bar", 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"{n} = :v0", "{c} > :v1"}, qb.filterConditions)
+}
+
+func TestPrepareErrors(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+
+	for statement, expected := range map[string]string{
+		"DELETE FROM TestStruct":                              "statement: expected SELECT at position 0",
+		"SELECT * FROM Nope":                                  "statement: expected the table TestStruct at position 14",
+		"SELECT Nope FROM TestStruct":                         "statement: unknown field or attribute: Nope at position 7",
+		"SELECT * FROM TestStruct USE INDEX Nope WHERE a = ?": "statement: unknown index: Nope",
+		"SELECT * FROM TestStruct WHERE a = ? OR B = ?":       "statement: OR is not supported at position 37",
+		"SELECT * FROM TestStruct WHERE a LIKE ?":             "statement: unknown operator LIKE at position 33",
+		"SELECT * FROM TestStruct WHERE a = b":                "statement: expected a value at position 35",
+		"SELECT * FROM TestStruct WHERE a = ? LIMIT 0":        "statement: expected a positive whole number at position 43",
+		"SELECT * FROM TestStruct WHERE a = ? LIMIT 5 ORDER":  "statement: unexpected ORDER at position 45",
+		"SELECT * FROM TestStruct WHERE a = ? AND B > ? AND B < ?": "statement: B is a key of table TestStruct and only " +
+			"one = condition on the hash key or key condition on the range key can be used",
+	} {
+		_, err := dao.Prepare(statement)
+		assert.EqualError(t, err, expected, statement)
+	}
+}
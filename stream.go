@@ -0,0 +1,393 @@
+package dynamoDao
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// StreamEventInsert is the EventName of a StreamEvent for an item that was added to the table.
+	StreamEventInsert = dynamodbstreams.OperationTypeInsert
+	// StreamEventModify is the EventName of a StreamEvent for an item that was changed.
+	StreamEventModify = dynamodbstreams.OperationTypeModify
+	// StreamEventRemove is the EventName of a StreamEvent for an item that was deleted from the table.
+	StreamEventRemove = dynamodbstreams.OperationTypeRemove
+
+	defaultStreamPollInterval = time.Second
+	defaultStreamBatchSize    = int64(100)
+	defaultStreamMaxPages     = 5
+)
+
+// StreamEvent is a change to an item of the table read from the table's stream.  OldImage and NewImage are pointers to
+// the DAO's struct type, and are nil when the stream's view type does not include them: OldImage is never set for an
+// INSERT and NewImage never for a REMOVE.
+type StreamEvent struct {
+	EventID                     string
+	EventName                   string
+	ShardId                     string
+	SequenceNumber              string
+	ApproximateCreationDateTime time.Time
+	Keys                        map[string]*dynamodb.AttributeValue
+	OldImage                    interface{}
+	NewImage                    interface{}
+}
+
+// CheckpointStore records how far a StreamReader has read each shard of a stream so that reading resumes where it left
+// off, e.g. after a restart.  GetCheckpoint returns an empty sequence number for a shard that has not been read.
+type CheckpointStore interface {
+	GetCheckpoint(streamArn, shardId string) (string, error)
+	SetCheckpoint(streamArn, shardId, sequenceNumber string) error
+}
+
+// MemoryCheckpointStore is a CheckpointStore that only lasts as long as the process.
+type MemoryCheckpointStore struct {
+	sync.Mutex
+	checkpoints map[string]string
+}
+
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{checkpoints: make(map[string]string)}
+}
+
+func (store *MemoryCheckpointStore) GetCheckpoint(streamArn, shardId string) (string, error) {
+	store.Lock()
+	defer store.Unlock()
+	return store.checkpoints[streamArn+"/"+shardId], nil
+}
+
+func (store *MemoryCheckpointStore) SetCheckpoint(streamArn, shardId, sequenceNumber string) error {
+	store.Lock()
+	defer store.Unlock()
+	store.checkpoints[streamArn+"/"+shardId] = sequenceNumber
+	return nil
+}
+
+// StreamReader reads the changes to the DAO's table from its DynamoDB stream, which must be enabled (see
+// NewDynamoDBDao's enableStreaming and streamViewType).  The shards of the stream are read parents first so the
+// changes to an item are delivered in order, and the sequence number of each record is checkpointed once it has been
+// handled.
+type StreamReader struct {
+	dao               *DynamoDBDao
+	Client            dynamodbstreamsiface.DynamoDBStreamsAPI
+	checkpoints       CheckpointStore
+	streamArn         string
+	shardIteratorType string
+	pollInterval      time.Duration
+	batchSize         int64
+	maxPages          int
+	positions         shardPositions
+}
+
+// Where each shard of a stream is read from next, kept between polls so that a poll carries on where the last one
+// stopped even if it read no records to checkpoint.  Closed shards read to their end are not read again.
+type shardPositions struct {
+	sync.Mutex
+	iterators map[string]*string
+	finished  map[string]bool
+}
+
+// Creates a reader of the table's stream.  If the client is nil, one is created with the configuration of the DAO's
+// DynamoDB client.  If the checkpoint store is nil, checkpoints are kept in memory.
+func (dao *DynamoDBDao) NewStreamReader(client dynamodbstreamsiface.DynamoDBStreamsAPI,
+	checkpoints CheckpointStore) *StreamReader {
+	if client == nil {
+		client = dynamodbstreams.New(session.New(&dao.Client.Config))
+	}
+	if checkpoints == nil {
+		checkpoints = NewMemoryCheckpointStore()
+	}
+	return &StreamReader{
+		dao:               dao,
+		Client:            client,
+		checkpoints:       checkpoints,
+		shardIteratorType: dynamodbstreams.ShardIteratorTypeTrimHorizon,
+		pollInterval:      defaultStreamPollInterval,
+		batchSize:         defaultStreamBatchSize,
+		maxPages:          defaultStreamMaxPages,
+		positions: shardPositions{
+			iterators: make(map[string]*string),
+			finished:  make(map[string]bool),
+		},
+	}
+}
+
+// Sets the ARN of the stream to read instead of discovering the table's current stream.
+func (sr *StreamReader) SetStreamArn(streamArn string) *StreamReader {
+	sr.streamArn = streamArn
+	return sr
+}
+
+// Sets where shards without a checkpoint are read from by the first poll that reads them, TRIM_HORIZON (the oldest
+// record, the default) or LATEST.
+func (sr *StreamReader) SetShardIteratorType(shardIteratorType string) *StreamReader {
+	sr.shardIteratorType = shardIteratorType
+	return sr
+}
+
+// Sets how long Run waits after reading all the shards before reading them again.
+func (sr *StreamReader) SetPollInterval(pollInterval time.Duration) *StreamReader {
+	sr.pollInterval = pollInterval
+	return sr
+}
+
+// Sets the maximum number of records read from a shard at a time.
+func (sr *StreamReader) SetBatchSize(batchSize int64) *StreamReader {
+	sr.batchSize = batchSize
+	return sr
+}
+
+// Sets the maximum number of batches read from a shard by each Poll.  An open shard never runs out of batches, and
+// may return empty ones before its latest records, so reading a shard stops after this many and the next poll carries
+// on from there; the default is 5.
+func (sr *StreamReader) SetMaxPagesPerShard(maxPages int) *StreamReader {
+	sr.maxPages = maxPages
+	return sr
+}
+
+// Returns the ARN of the stream being read, discovering the table's enabled stream the first time it is called.
+func (sr *StreamReader) StreamArn(ctx context.Context) (string, error) {
+	if sr.streamArn != "" {
+		return sr.streamArn, nil
+	}
+	input := new(dynamodbstreams.ListStreamsInput).SetTableName(sr.dao.TableName)
+	for {
+		output, err := sr.Client.ListStreamsWithContext(ctx, input)
+		if err != nil {
+			return "", err
+		}
+		for _, stream := range output.Streams {
+			description, err := sr.Client.DescribeStreamWithContext(ctx,
+				new(dynamodbstreams.DescribeStreamInput).SetStreamArn(aws.StringValue(stream.StreamArn)).SetLimit(1))
+			if err != nil {
+				return "", err
+			}
+			status := aws.StringValue(description.StreamDescription.StreamStatus)
+			if status == dynamodbstreams.StreamStatusEnabled || status == dynamodbstreams.StreamStatusEnabling {
+				sr.streamArn = aws.StringValue(stream.StreamArn)
+				return sr.streamArn, nil
+			}
+		}
+		if output.LastEvaluatedStreamArn == nil {
+			return "", errors.New("table " + sr.dao.TableName + " does not have an enabled stream")
+		}
+		input = input.SetExclusiveStartStreamArn(*output.LastEvaluatedStreamArn)
+	}
+}
+
+// Reads every shard of the stream up to its latest record, or as many batches of it as allowed (see
+// SetMaxPagesPerShard), passing each change to the handler.  Each shard is read from where the last poll stopped.  If
+// the handler returns an error, reading stops and the error is returned; the record is not checkpointed so it is read
+// again next time.  Polls of the same reader take turns.
+func (sr *StreamReader) Poll(ctx context.Context, handler func(*StreamEvent) error) error {
+	if sr.dao.tenant != nil {
+		return sr.dao.tenant.crossTenant("streams cannot be read through a DAO scoped to tenant %s",
+			sr.dao.tenant.tenantID)
+	}
+	streamArn, err := sr.StreamArn(ctx)
+	if err != nil {
+		return err
+	}
+	shards, err := sr.shards(ctx, streamArn)
+	if err != nil {
+		return err
+	}
+	sr.positions.Lock()
+	defer sr.positions.Unlock()
+	sr.positions.forget(streamArn, shards)
+	for _, shard := range shards {
+		if err := sr.readShard(ctx, streamArn, aws.StringValue(shard.ShardId), handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forgets the positions of the shards that are no longer in the stream, or of another stream.
+func (positions *shardPositions) forget(streamArn string, shards []*dynamodbstreams.Shard) {
+	current := make(map[string]bool, len(shards))
+	for _, shard := range shards {
+		current[streamArn+"/"+aws.StringValue(shard.ShardId)] = true
+	}
+	for position := range positions.iterators {
+		if !current[position] {
+			delete(positions.iterators, position)
+		}
+	}
+	for position := range positions.finished {
+		if !current[position] {
+			delete(positions.finished, position)
+		}
+	}
+}
+
+// Polls the stream until the context is done or the handler returns an error.
+func (sr *StreamReader) Run(ctx context.Context, handler func(*StreamEvent) error) error {
+	for {
+		if err := sr.Poll(ctx, handler); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(sr.pollInterval):
+		}
+	}
+}
+
+// Lists the shards of the stream, ordered so that every shard comes after its parent.
+func (sr *StreamReader) shards(ctx context.Context, streamArn string) ([]*dynamodbstreams.Shard, error) {
+	shards := make([]*dynamodbstreams.Shard, 0)
+	input := new(dynamodbstreams.DescribeStreamInput).SetStreamArn(streamArn)
+	for {
+		output, err := sr.Client.DescribeStreamWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, output.StreamDescription.Shards...)
+		if output.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		input = input.SetExclusiveStartShardId(*output.StreamDescription.LastEvaluatedShardId)
+	}
+	byId := make(map[string]*dynamodbstreams.Shard, len(shards))
+	for _, shard := range shards {
+		byId[aws.StringValue(shard.ShardId)] = shard
+	}
+	sort.SliceStable(shards, func(i, j int) bool {
+		return shardDepth(shards[i], byId) < shardDepth(shards[j], byId)
+	})
+	return shards, nil
+}
+
+// The number of ancestors of the shard still in the stream.
+func shardDepth(shard *dynamodbstreams.Shard, byId map[string]*dynamodbstreams.Shard) int {
+	depth := 0
+	for parent := byId[aws.StringValue(shard.ParentShardId)]; parent != nil && depth < len(byId); depth++ {
+		parent = byId[aws.StringValue(parent.ParentShardId)]
+	}
+	return depth
+}
+
+// Reads the shard from where the last poll stopped, from its checkpoint if no poll has read it yet.
+func (sr *StreamReader) readShard(ctx context.Context, streamArn, shardId string,
+	handler func(*StreamEvent) error) error {
+	position := streamArn + "/" + shardId
+	if sr.positions.finished[position] {
+		return nil
+	}
+	// The saved iterator is only put back when reading stops cleanly, so that a failed read carries on from the
+	// checkpoint, or from the batch it failed on if none of it was checkpointed.
+	shardIterator, saved := sr.positions.iterators[position]
+	delete(sr.positions.iterators, position)
+	if !saved {
+		var err error
+		if shardIterator, err = sr.newShardIterator(ctx, streamArn, shardId); err != nil {
+			return err
+		}
+	}
+	for pages := 0; shardIterator != nil && pages < sr.maxPages; pages++ {
+		output, err := sr.Client.GetRecordsWithContext(ctx,
+			new(dynamodbstreams.GetRecordsInput).SetShardIterator(*shardIterator).SetLimit(sr.batchSize))
+		if awsErr, ok := err.(awserr.Error); ok && saved &&
+			awsErr.Code() == dynamodbstreams.ErrCodeExpiredIteratorException {
+			// Iterators expire after 15 minutes, so a slow poll carries on from the checkpoint instead.
+			if shardIterator, err = sr.newShardIterator(ctx, streamArn, shardId); err != nil {
+				return err
+			}
+			saved = false
+			pages--
+			continue
+		}
+		saved = false
+		if err != nil {
+			return err
+		}
+		for i, record := range output.Records {
+			event, err := sr.event(shardId, record)
+			if err != nil {
+				return err
+			}
+			if err := handler(event); err != nil {
+				if i == 0 {
+					// Nothing of the batch was checkpointed, so it is read again from its iterator.
+					sr.positions.iterators[position] = shardIterator
+				}
+				return err
+			}
+			if err := sr.checkpoints.SetCheckpoint(streamArn, shardId, event.SequenceNumber); err != nil {
+				return err
+			}
+		}
+		// An empty batch does not mean the shard has been read to its end, only a closed shard's last batch has no
+		// next iterator.
+		shardIterator = output.NextShardIterator
+	}
+	if shardIterator == nil {
+		sr.positions.finished[position] = true
+	} else {
+		sr.positions.iterators[position] = shardIterator
+	}
+	return nil
+}
+
+// Gets an iterator reading the shard after its checkpoint, or from where the reader is set to start if it has none.
+func (sr *StreamReader) newShardIterator(ctx context.Context, streamArn, shardId string) (*string, error) {
+	sequenceNumber, err := sr.checkpoints.GetCheckpoint(streamArn, shardId)
+	if err != nil {
+		return nil, err
+	}
+	iteratorInput := new(dynamodbstreams.GetShardIteratorInput).SetStreamArn(streamArn).SetShardId(shardId)
+	if sequenceNumber != "" {
+		iteratorInput = iteratorInput.SetShardIteratorType(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber).
+			SetSequenceNumber(sequenceNumber)
+	} else {
+		iteratorInput = iteratorInput.SetShardIteratorType(sr.shardIteratorType)
+	}
+	iterator, err := sr.Client.GetShardIteratorWithContext(ctx, iteratorInput)
+	if err != nil {
+		return nil, err
+	}
+	return iterator.ShardIterator, nil
+}
+
+// Converts the stream record to an event, unmarshaling its images into the DAO's struct type.
+func (sr *StreamReader) event(shardId string, record *dynamodbstreams.Record) (*StreamEvent, error) {
+	event := &StreamEvent{
+		EventID:   aws.StringValue(record.EventID),
+		EventName: aws.StringValue(record.EventName),
+		ShardId:   shardId,
+	}
+	if record.Dynamodb == nil {
+		return event, nil
+	}
+	event.SequenceNumber = aws.StringValue(record.Dynamodb.SequenceNumber)
+	event.ApproximateCreationDateTime = aws.TimeValue(record.Dynamodb.ApproximateCreationDateTime)
+	event.Keys = record.Dynamodb.Keys
+	if record.Dynamodb.OldImage != nil {
+		oldImage, err := sr.dao.UnmarshalAttributes(record.Dynamodb.OldImage)
+		if err != nil {
+			return nil, err
+		}
+		event.OldImage = oldImage
+	}
+	if record.Dynamodb.NewImage != nil {
+		newImage, err := sr.dao.UnmarshalAttributes(record.Dynamodb.NewImage)
+		if err != nil {
+			return nil, err
+		}
+		event.NewImage = newImage
+	}
+	return event, nil
+}
@@ -0,0 +1,328 @@
+package dynamoDao
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams/dynamodbstreamsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// A fake stream with shards holding records.  Shard iterators are "shardId/position/empty", where empty is the number
+// of empty batches returned before the records from the position.
+type fakeStreamsClient struct {
+	dynamodbstreamsiface.DynamoDBStreamsAPI
+	streams map[string]string
+	shards  []*dynamodbstreams.Shard
+	records map[string][]*dynamodbstreams.Record
+	closed  map[string]bool
+	// The number of empty batches read from a new iterator of the shard, and the iterators that have expired.
+	empty   map[string]int
+	expired map[string]bool
+	reads   map[string]int
+}
+
+func (c *fakeStreamsClient) ListStreamsWithContext(ctx aws.Context, input *dynamodbstreams.ListStreamsInput,
+	opts ...request.Option) (*dynamodbstreams.ListStreamsOutput, error) {
+	output := new(dynamodbstreams.ListStreamsOutput)
+	for arn := range c.streams {
+		output.Streams = append(output.Streams, new(dynamodbstreams.Stream).SetStreamArn(arn).
+			SetTableName(*input.TableName))
+	}
+	return output, nil
+}
+
+func (c *fakeStreamsClient) DescribeStreamWithContext(ctx aws.Context, input *dynamodbstreams.DescribeStreamInput,
+	opts ...request.Option) (*dynamodbstreams.DescribeStreamOutput, error) {
+	description := new(dynamodbstreams.StreamDescription).SetStreamArn(*input.StreamArn).
+		SetStreamStatus(c.streams[*input.StreamArn])
+	// One shard per page to exercise paging.
+	start := 0
+	if input.ExclusiveStartShardId != nil {
+		for i, shard := range c.shards {
+			if *shard.ShardId == *input.ExclusiveStartShardId {
+				start = i + 1
+			}
+		}
+	}
+	if start < len(c.shards) {
+		description.SetShards(c.shards[start : start+1])
+		if start+1 < len(c.shards) {
+			description.SetLastEvaluatedShardId(*c.shards[start].ShardId)
+		}
+	}
+	return new(dynamodbstreams.DescribeStreamOutput).SetStreamDescription(description), nil
+}
+
+func (c *fakeStreamsClient) GetShardIteratorWithContext(ctx aws.Context, input *dynamodbstreams.GetShardIteratorInput,
+	opts ...request.Option) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	position := 0
+	records := c.records[*input.ShardId]
+	switch *input.ShardIteratorType {
+	case dynamodbstreams.ShardIteratorTypeAfterSequenceNumber:
+		for i, record := range records {
+			if *record.Dynamodb.SequenceNumber == *input.SequenceNumber {
+				position = i + 1
+			}
+		}
+	case dynamodbstreams.ShardIteratorTypeLatest:
+		position = len(records)
+	}
+	shardIterator := *input.ShardId + "/" + strconv.Itoa(position) + "/" + strconv.Itoa(c.empty[*input.ShardId])
+	return new(dynamodbstreams.GetShardIteratorOutput).SetShardIterator(shardIterator), nil
+}
+
+func (c *fakeStreamsClient) GetRecordsWithContext(ctx aws.Context, input *dynamodbstreams.GetRecordsInput,
+	opts ...request.Option) (*dynamodbstreams.GetRecordsOutput, error) {
+	if c.expired[*input.ShardIterator] {
+		delete(c.expired, *input.ShardIterator)
+		return nil, awserr.New(dynamodbstreams.ErrCodeExpiredIteratorException, "iterator expired", nil)
+	}
+	parts := strings.Split(*input.ShardIterator, "/")
+	shardId := parts[0]
+	position, _ := strconv.Atoi(parts[1])
+	empty, _ := strconv.Atoi(parts[2])
+	c.reads[shardId]++
+	// Open shards may return empty batches before records that are already there.
+	if empty > 0 {
+		return new(dynamodbstreams.GetRecordsOutput).SetRecords(nil).
+			SetNextShardIterator(shardId + "/" + parts[1] + "/" + strconv.Itoa(empty-1)), nil
+	}
+	records := c.records[shardId][position:]
+	if int64(len(records)) > *input.Limit {
+		records = records[:*input.Limit]
+	}
+	output := new(dynamodbstreams.GetRecordsOutput).SetRecords(records)
+	if position+len(records) < len(c.records[shardId]) || !c.closed[shardId] {
+		output.SetNextShardIterator(shardId + "/" + strconv.Itoa(position+len(records)) + "/0")
+	}
+	return output, nil
+}
+
+func streamRecord(t *testing.T, eventName, sequenceNumber string, oldImage, newImage *Struct3) *dynamodbstreams.Record {
+	streamRecord := new(dynamodbstreams.StreamRecord).SetSequenceNumber(sequenceNumber)
+	for _, image := range []*Struct3{oldImage, newImage} {
+		if image == nil {
+			continue
+		}
+		attrs, err := dynamodbattribute.MarshalMap(image)
+		require.NoError(t, err)
+		streamRecord.SetKeys(map[string]*dynamodb.AttributeValue{
+			"organization_id": attrs["organization_id"], "person_id": attrs["person_id"]})
+		if image == oldImage {
+			streamRecord.SetOldImage(attrs)
+		} else {
+			streamRecord.SetNewImage(attrs)
+		}
+	}
+	return new(dynamodbstreams.Record).SetEventID("event" + sequenceNumber).SetEventName(eventName).
+		SetDynamodb(streamRecord)
+}
+
+func newFakeStream(t *testing.T) *fakeStreamsClient {
+	joe := &Struct3{OrgId: "org", Id: "1", Name: "Joe"}
+	joseph := &Struct3{OrgId: "org", Id: "1", Name: "Joseph"}
+	jane := &Struct3{OrgId: "org", Id: "2", Name: "Jane"}
+	return &fakeStreamsClient{
+		streams: map[string]string{"arn:stream": dynamodbstreams.StreamStatusEnabled},
+		// The child shard is listed first, it must still be read after its parent.
+		shards: []*dynamodbstreams.Shard{
+			new(dynamodbstreams.Shard).SetShardId("child").SetParentShardId("parent"),
+			new(dynamodbstreams.Shard).SetShardId("parent"),
+		},
+		records: map[string][]*dynamodbstreams.Record{
+			"parent": {
+				streamRecord(t, StreamEventInsert, "100000000000000000001", nil, joe),
+				streamRecord(t, StreamEventModify, "100000000000000000002", joe, joseph),
+			},
+			"child": {
+				streamRecord(t, StreamEventInsert, "100000000000000000003", nil, jane),
+				streamRecord(t, StreamEventRemove, "100000000000000000004", joseph, nil),
+			},
+		},
+		closed:  map[string]bool{"parent": true},
+		empty:   make(map[string]int),
+		expired: make(map[string]bool),
+		reads:   make(map[string]int),
+	}
+}
+
+func TestStreamReader_Poll(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	client := newFakeStream(t)
+	checkpoints := NewMemoryCheckpointStore()
+	reader := dao.NewStreamReader(client, checkpoints).SetBatchSize(1)
+
+	events := make([]*StreamEvent, 0)
+	err := reader.Poll(context.Background(), func(event *StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(events))
+	assert.Equal(t, StreamEventInsert, events[0].EventName)
+	assert.Equal(t, "parent", events[0].ShardId)
+	assert.Nil(t, events[0].OldImage)
+	assert.Equal(t, "Joe", events[0].NewImage.(*Struct3).Name)
+	assert.Equal(t, StreamEventModify, events[1].EventName)
+	assert.Equal(t, "Joe", events[1].OldImage.(*Struct3).Name)
+	assert.Equal(t, "Joseph", events[1].NewImage.(*Struct3).Name)
+	assert.Equal(t, "child", events[2].ShardId)
+	assert.Equal(t, "Jane", events[2].NewImage.(*Struct3).Name)
+	assert.Equal(t, StreamEventRemove, events[3].EventName)
+	assert.Equal(t, "Joseph", events[3].OldImage.(*Struct3).Name)
+	assert.Nil(t, events[3].NewImage)
+	assert.Equal(t, "1", *events[3].Keys["person_id"].S)
+
+	checkpoint, err := checkpoints.GetCheckpoint("arn:stream", "child")
+	require.NoError(t, err)
+	assert.Equal(t, "100000000000000000004", checkpoint)
+
+	// Only new records are delivered by the next poll.
+	client.records["child"] = append(client.records["child"],
+		streamRecord(t, StreamEventInsert, "100000000000000000005", nil, &Struct3{OrgId: "org", Id: "3"}))
+	events = events[:0]
+	err = reader.Poll(context.Background(), func(event *StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(events))
+	assert.Equal(t, "100000000000000000005", events[0].SequenceNumber)
+}
+
+func TestStreamReader_EmptyBatches(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	client := newFakeStream(t)
+	client.empty["child"] = 2
+	reader := dao.NewStreamReader(client, nil)
+
+	sequenceNumbers := make([]string, 0)
+	handler := func(event *StreamEvent) error {
+		sequenceNumbers = append(sequenceNumbers, event.SequenceNumber)
+		return nil
+	}
+	require.NoError(t, reader.Poll(context.Background(), handler))
+	assert.Equal(t, 4, len(sequenceNumbers))
+
+	// Reading stops after the maximum number of batches, and carries on from there the next time, even when more empty
+	// batches than that come before the first record.
+	client = newFakeStream(t)
+	client.empty["child"] = 3
+	reader = dao.NewStreamReader(client, nil).SetMaxPagesPerShard(1)
+	sequenceNumbers = sequenceNumbers[:0]
+	for poll := 0; poll < 3; poll++ {
+		require.NoError(t, reader.Poll(context.Background(), handler))
+	}
+	assert.Equal(t, []string{"100000000000000000001", "100000000000000000002"}, sequenceNumbers)
+	require.NoError(t, reader.Poll(context.Background(), handler))
+	assert.Equal(t, 4, len(sequenceNumbers))
+
+	// The closed parent shard was read to its end by the first poll and is not read again.
+	assert.Equal(t, 1, client.reads["parent"])
+	assert.Equal(t, 4, client.reads["child"])
+}
+
+func TestStreamReader_Latest(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	client := newFakeStream(t)
+	reader := dao.NewStreamReader(client, nil).SetShardIteratorType(dynamodbstreams.ShardIteratorTypeLatest)
+
+	sequenceNumbers := make([]string, 0)
+	handler := func(event *StreamEvent) error {
+		sequenceNumbers = append(sequenceNumbers, event.SequenceNumber)
+		return nil
+	}
+	require.NoError(t, reader.Poll(context.Background(), handler))
+	assert.Empty(t, sequenceNumbers)
+
+	// Records written after a poll that read nothing are read by the next one, and again if the handler fails before
+	// any was checkpointed.
+	client.records["child"] = append(client.records["child"],
+		streamRecord(t, StreamEventInsert, "100000000000000000005", nil, &Struct3{OrgId: "org", Id: "3"}))
+	err := reader.Poll(context.Background(), func(event *StreamEvent) error {
+		return errors.New("boom")
+	})
+	assert.EqualError(t, err, "boom")
+	require.NoError(t, reader.Poll(context.Background(), handler))
+	assert.Equal(t, []string{"100000000000000000005"}, sequenceNumbers)
+
+	// An iterator that expired between polls is replaced by one after the checkpoint.
+	client.expired["child/3/0"] = true
+	client.records["child"] = append(client.records["child"],
+		streamRecord(t, StreamEventInsert, "100000000000000000006", nil, &Struct3{OrgId: "org", Id: "4"}))
+	require.NoError(t, reader.Poll(context.Background(), handler))
+	assert.Equal(t, []string{"100000000000000000005", "100000000000000000006"}, sequenceNumbers)
+	assert.Empty(t, client.expired)
+}
+
+func TestStreamReader_HandlerError(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	checkpoints := NewMemoryCheckpointStore()
+	reader := dao.NewStreamReader(newFakeStream(t), checkpoints)
+
+	failed := false
+	err := reader.Poll(context.Background(), func(event *StreamEvent) error {
+		if event.EventName == StreamEventModify && !failed {
+			failed = true
+			return errors.New("boom")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "boom")
+	checkpoint, err := checkpoints.GetCheckpoint("arn:stream", "parent")
+	require.NoError(t, err)
+	assert.Equal(t, "100000000000000000001", checkpoint)
+
+	// The failed record is delivered again.
+	names := make([]string, 0)
+	err = reader.Poll(context.Background(), func(event *StreamEvent) error {
+		names = append(names, event.EventName)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{StreamEventModify, StreamEventInsert, StreamEventRemove}, names)
+}
+
+func TestStreamReader_StreamArn(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	client := newFakeStream(t)
+	client.streams = map[string]string{"arn:disabled": dynamodbstreams.StreamStatusDisabled}
+	_, err := dao.NewStreamReader(client, nil).StreamArn(context.Background())
+	assert.EqualError(t, err, "table Struct3 does not have an enabled stream")
+
+	client.streams["arn:enabled"] = dynamodbstreams.StreamStatusEnabled
+	streamArn, err := dao.NewStreamReader(client, nil).StreamArn(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "arn:enabled", streamArn)
+
+	streamArn, err = dao.NewStreamReader(client, nil).SetStreamArn("arn:given").StreamArn(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "arn:given", streamArn)
+}
+
+func TestStreamReader_Run(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	reader := dao.NewStreamReader(newFakeStream(t), nil).SetPollInterval(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err := reader.Run(ctx, func(event *StreamEvent) error {
+		count++
+		if count == 4 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 4, count)
+}
@@ -0,0 +1,303 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	tenantTag = "dynamoTenant"
+	// Separates the tenant ID from the rest of a hash key it is prefixed to.
+	tenantSeparator = "#"
+)
+
+// An equality condition between an attribute (or its alias) and a value placeholder in a key condition expression.
+var (
+	attrEqualsValueRegex = regexp.MustCompile("(?:^|[\\s(])(#?[\\w.]+)\\s*=\\s*(:\\w+)")
+	valueEqualsAttrRegex = regexp.MustCompile("(:\\w+)\\s*=\\s*(#?[\\w.]+)")
+)
+
+// The tenant a DAO is scoped to.
+type tenantScope struct {
+	tenantID string
+	// The hash keys of the table and its global secondary indexes, mapped to whether the tenant ID is prefixed to
+	// them (true) or set in them through the tenant field of their key template (false).
+	hashKeys map[string]bool
+}
+
+// Returns a DAO for the same table scoped to the tenant, which keeps every item, key and query within the tenant:
+//
+//   - The hash keys of the table and of its global secondary indexes are prefixed with the tenant ID and '#' when
+//     items and keys are marshaled, and the prefix is stripped from them when items are read and when they are
+//     grouped by aggregations.  A hash key built from a key template that refers to a string field tagged with
+//     dynamoTenant (e.g. pk=TENANT#{TenantId}#USER#{Id}) is not prefixed; the field is set to the tenant ID instead.
+//   - The value the hash key of a query is compared to is prefixed, or checked against the tenant for a templated
+//     hash key, so PagedQuery, QueryBuilder and FindBy are given the values as they would be without tenants.
+//   - Items, keys and queries of another tenant, and scans and stream reads, which would cross tenants, fail with
+//     ErrCrossTenant.  Approximate totals are counted exactly, since the table's item count covers every tenant.
+//
+// Tenant IDs cannot be empty or contain '#'.  The scoped DAO shares the client, caches, collectors, interceptors,
+// retry policy and registered types of this DAO as they are when it is created, but caches counts separately.  Hash
+// keys that are prefixed must be strings.
+func (dao *DynamoDBDao) ForTenant(tenantID string) (*DynamoDBDao, error) {
+	if dao.tenant != nil {
+		return nil, errors.New("the DAO is already scoped to tenant " + dao.tenant.tenantID)
+	}
+	if tenantID == "" || strings.Contains(tenantID, tenantSeparator) {
+		return nil, fmt.Errorf("invalid tenant ID %q: tenant IDs cannot be empty or contain %q", tenantID,
+			tenantSeparator)
+	}
+	scope := &tenantScope{tenantID: tenantID, hashKeys: make(map[string]bool)}
+	hashKeys := []*dynamodb.KeySchemaElement{dao.tableDescription.KeySchema[0]}
+	for _, gsi := range dao.tableDescription.GlobalSecondaryIndexes {
+		hashKeys = append(hashKeys, gsi.KeySchema[0])
+	}
+	for _, hashKey := range hashKeys {
+		attrName := aws.StringValue(hashKey.AttributeName)
+		if tenantTemplated(dao.structType, dao.keyTemplates, attrName) {
+			for _, rt := range dao.types {
+				if !tenantTemplated(rt.structType, rt.keyTemplates, attrName) {
+					return nil, fmt.Errorf("the key template of %s in %s must refer to a %s field", attrName,
+						rt.structType, tenantTag)
+				}
+			}
+			scope.hashKeys[attrName] = false
+			continue
+		}
+		for _, attrDef := range dao.tableDescription.AttributeDefinitions {
+			if aws.StringValue(attrDef.AttributeName) == attrName &&
+				aws.StringValue(attrDef.AttributeType) != dynamodb.ScalarAttributeTypeS {
+				return nil, errors.New("the hash key " + attrName + " is not a string and cannot be scoped to a tenant")
+			}
+		}
+		scope.hashKeys[attrName] = true
+	}
+
+	scoped := &DynamoDBDao{
+		Client:           dao.Client,
+		TableName:        dao.TableName,
+		structType:       dao.structType,
+		readCapacity:     dao.readCapacity,
+		writeCapacity:    dao.writeCapacity,
+		enableStreaming:  dao.enableStreaming,
+		streamViewType:   dao.streamViewType,
+		consistentRead:   dao.consistentRead,
+		descending:       dao.descending,
+		totalMode:        dao.totalMode,
+		tokenKey:         dao.tokenKey,
+		encryptTokens:    dao.encryptTokens,
+		keyAttrNames:     dao.keyAttrNames,
+		attrToField:      dao.attrToField,
+		tableDescription: dao.tableDescription,
+		itemCache:        dao.itemCache,
+		itemCacheStats:   dao.itemCacheStats,
+		metrics:          dao.metrics,
+		logger:           dao.logger,
+		logUnredacted:    dao.logUnredacted,
+		interceptors:     append([]Interceptor(nil), dao.interceptors...),
+		retryPolicy:      dao.retryPolicy,
+		notFoundError:    dao.notFoundError,
+		keyTemplates:     dao.keyTemplates,
+		typeAttribute:    dao.typeAttribute,
+		tenant:           scope,
+		deletedAt:        dao.deletedAt,
+	}
+	dao.counts.Lock()
+	scoped.counts.ttl = dao.counts.ttl
+	dao.counts.Unlock()
+	scoped.logRequests = atomic.LoadInt32(&dao.logRequests)
+	for discriminator, rt := range dao.types {
+		if scoped.types == nil {
+			scoped.types = make(map[string]*registeredType)
+		}
+		scoped.types[discriminator] = rt
+	}
+	return scoped, nil
+}
+
+// Returns the tenant the DAO is scoped to, empty if it isn't (see ForTenant).
+func (dao *DynamoDBDao) TenantID() string {
+	if dao.tenant == nil {
+		return ""
+	}
+	return dao.tenant.tenantID
+}
+
+// Returns the field of the struct type tagged with dynamoTenant.
+func tenantField(structType reflect.Type) (reflect.StructField, bool) {
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		if _, ok := field.Tag.Lookup(tenantTag); ok && field.Type.Kind() == reflect.String {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// Returns whether the attribute is built from a key template that refers to the tenant field of the struct type.
+func tenantTemplated(structType reflect.Type, keyTemplates []*keyTemplate, attrName string) bool {
+	field, ok := tenantField(structType)
+	if !ok {
+		return false
+	}
+	for _, kt := range keyTemplates {
+		if kt.attrName != attrName {
+			continue
+		}
+		for _, templateField := range kt.fields {
+			if reflect.DeepEqual(templateField.Index, field.Index) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (scope *tenantScope) crossTenant(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrCrossTenant}, args...)...)
+}
+
+// Returns the item with its tenant field set to the DAO's tenant: a copy of it if it has a tenant field, the item
+// itself if it doesn't.
+func (dao *DynamoDBDao) withTenant(item interface{}) (interface{}, error) {
+	if dao.tenant == nil {
+		return item, nil
+	}
+	value, _, ok := dao.structValue(item)
+	if !ok {
+		return item, nil
+	}
+	field, ok := tenantField(value.Type())
+	if !ok {
+		return item, nil
+	}
+	if tenantID := value.FieldByIndex(field.Index).String(); tenantID != "" && tenantID != dao.tenant.tenantID {
+		return nil, dao.tenant.crossTenant("the item belongs to tenant %s", tenantID)
+	}
+	scoped := reflect.New(value.Type())
+	scoped.Elem().Set(value)
+	scoped.Elem().FieldByIndex(field.Index).SetString(dao.tenant.tenantID)
+	return scoped.Interface(), nil
+}
+
+// Prefixes the tenant ID to the hash keys of the item's attributes.
+func (dao *DynamoDBDao) scopeAttributes(attrVals map[string]*dynamodb.AttributeValue) error {
+	if dao.tenant == nil {
+		return nil
+	}
+	for attrName, prefixed := range dao.tenant.hashKeys {
+		attrVal, ok := attrVals[attrName]
+		if !ok || !prefixed {
+			continue
+		}
+		if attrVal.S == nil {
+			return errors.New("the hash key " + attrName + " is not a string and cannot be scoped to a tenant")
+		}
+		attrVals[attrName] = new(dynamodb.AttributeValue).SetS(dao.tenant.tenantID + tenantSeparator + *attrVal.S)
+	}
+	return nil
+}
+
+// Strips the tenant ID from the hash keys of the item's attributes, returning a copy of them.  Attributes of another
+// tenant are an ErrCrossTenant.
+func (dao *DynamoDBDao) unscopeAttributes(
+	attributes map[string]*dynamodb.AttributeValue) (map[string]*dynamodb.AttributeValue, error) {
+	if dao.tenant == nil {
+		return attributes, nil
+	}
+	unscoped := make(map[string]*dynamodb.AttributeValue, len(attributes))
+	for attrName, attrVal := range attributes {
+		unscoped[attrName] = attrVal
+	}
+	prefix := dao.tenant.tenantID + tenantSeparator
+	for attrName, prefixed := range dao.tenant.hashKeys {
+		attrVal, ok := attributes[attrName]
+		if !ok || !prefixed {
+			continue
+		}
+		if attrVal.S == nil || !strings.HasPrefix(*attrVal.S, prefix) {
+			return nil, dao.tenant.crossTenant("the item's %s is not in tenant %s", attrName, dao.tenant.tenantID)
+		}
+		unscoped[attrName] = new(dynamodb.AttributeValue).SetS(strings.TrimPrefix(*attrVal.S, prefix))
+	}
+	return unscoped, nil
+}
+
+// Checks that an item read belongs to the DAO's tenant.  An item whose tenant field is empty, e.g. because it was not
+// projected, is taken to belong to it, as the hash key it was read by does.
+func (dao *DynamoDBDao) checkTenant(item interface{}) error {
+	if dao.tenant == nil {
+		return nil
+	}
+	value := reflect.Indirect(reflect.ValueOf(item))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	field, ok := tenantField(value.Type())
+	if !ok {
+		return nil
+	}
+	if tenantID := value.FieldByIndex(field.Index).String(); tenantID != "" && tenantID != dao.tenant.tenantID {
+		return dao.tenant.crossTenant("the item belongs to tenant %s", tenantID)
+	}
+	return nil
+}
+
+// Returns a copy of the query with the value its hash key is compared to scoped to the DAO's tenant: prefixed with the
+// tenant ID, or checked to be of the tenant if the hash key is built from a key template with the tenant field.
+func (dao *DynamoDBDao) scopeQuery(query *dynamodb.QueryInput) (*dynamodb.QueryInput, error) {
+	if dao.tenant == nil {
+		return query, nil
+	}
+	keySchema, err := dao.indexKeySchema(aws.StringValue(query.IndexName))
+	if err != nil {
+		return nil, err
+	}
+	hashKey := aws.StringValue(keySchema[0].AttributeName)
+	placeholder := ""
+	expression := aws.StringValue(query.KeyConditionExpression)
+	resolve := func(name string) string {
+		if attrName, ok := query.ExpressionAttributeNames[name]; ok {
+			return aws.StringValue(attrName)
+		}
+		return name
+	}
+	for _, match := range attrEqualsValueRegex.FindAllStringSubmatch(expression, -1) {
+		if resolve(match[1]) == hashKey {
+			placeholder = match[2]
+		}
+	}
+	for _, match := range valueEqualsAttrRegex.FindAllStringSubmatch(expression, -1) {
+		if resolve(match[2]) == hashKey {
+			placeholder = match[1]
+		}
+	}
+	value, ok := query.ExpressionAttributeValues[placeholder]
+	if placeholder == "" || !ok || value.S == nil {
+		return nil, dao.tenant.crossTenant("the query has no string condition on the hash key %s", hashKey)
+	}
+	if !dao.tenant.hashKeys[hashKey] {
+		item := reflect.New(dao.structType).Elem()
+		if err := dao.keyTemplate(hashKey).parse(*value.S, item); err != nil {
+			return nil, err
+		}
+		field, _ := tenantField(dao.structType)
+		if tenantID := item.FieldByIndex(field.Index).String(); tenantID != dao.tenant.tenantID {
+			return nil, dao.tenant.crossTenant("the query is of tenant %q", tenantID)
+		}
+		return query, nil
+	}
+	values := make(map[string]*dynamodb.AttributeValue, len(query.ExpressionAttributeValues))
+	for name, attrVal := range query.ExpressionAttributeValues {
+		values[name] = attrVal
+	}
+	values[placeholder] = new(dynamodb.AttributeValue).SetS(dao.tenant.tenantID + tenantSeparator + *value.S)
+	scoped := *query
+	return scoped.SetExpressionAttributeValues(values), nil
+}
@@ -0,0 +1,164 @@
+package dynamoDao
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+type TenantUser struct {
+	TenantId string `dynamodbav:"tenant_id" dynamoTenant:""`
+	Id       string `dynamodbav:"id" dynamoKey:"hash,pk=TENANT#{TenantId}#USER#{Id}"`
+	Email    string `dynamodbav:"email" dynamoGSI:"ByEmail,hash"`
+}
+
+func TestForTenantPrefixesHashKeys(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	scoped, err := dao.ForTenant("acme")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", scoped.TenantID())
+	assert.Equal(t, "", dao.TenantID())
+	fake := new(requestRecorder)
+	scoped.SetLogger(nil).AddInterceptors(fake.intercept)
+
+	_, err = scoped.PutItem(&Struct3{OrgId: "org", Id: "1"})
+	require.NoError(t, err)
+	put := fake.inputs[0].(*dynamodb.PutItemInput)
+	assert.Equal(t, "acme#org", *put.Item["organization_id"].S)
+	assert.Equal(t, "1", *put.Item["person_id"].S)
+
+	fake.item = put.Item
+	item, err := scoped.GetItem(&Struct3{OrgId: "org", Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme#org", *fake.inputs[1].(*dynamodb.GetItemInput).Key["organization_id"].S)
+	assert.Equal(t, &Struct3{OrgId: "org", Id: "1"}, item)
+
+	page, err := scoped.PagedQuery("", "{OrgId} = :o", "", map[string]interface{}{":o": "org"}, nil, 0, 10,
+		TotalSizeMode(TotalApproximate))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), page.TotalSize)
+	assert.Equal(t, []interface{}{&Struct3{OrgId: "org", Id: "1"}}, page.Data)
+	for _, input := range fake.inputs[2:] {
+		query := input.(*dynamodb.QueryInput)
+		assert.Equal(t, "acme#org", *query.ExpressionAttributeValues[":o"].S)
+	}
+
+	// Items, queries and scans that would cross tenants are refused.
+	fake.item = map[string]*dynamodb.AttributeValue{
+		"organization_id": new(dynamodb.AttributeValue).SetS("other#org"),
+		"person_id":       new(dynamodb.AttributeValue).SetS("1"),
+	}
+	_, err = scoped.GetItem(&Struct3{OrgId: "org", Id: "1"})
+	assert.True(t, errors.Is(err, ErrCrossTenant))
+	_, err = scoped.PagedQuery("", "{Id} = :i", "", map[string]interface{}{":i": "1"}, nil, 0, 10)
+	assert.EqualError(t, err,
+		"CountQuery Struct3: cross-tenant access: the query has no string condition on the hash key organization_id")
+	_, err = scoped.PagedScan("", 0, 10, TotalSizeMode(TotalNone))
+	assert.EqualError(t, err, "Scan Struct3: cross-tenant access: scans are not allowed on a DAO scoped to tenant acme")
+	assert.True(t, errors.Is(scoped.NewStreamReader(nil, nil).Poll(context.Background(), nil), ErrCrossTenant))
+
+	// The DAO it was scoped from is not.
+	attrVals, err := dao.MarshalAttributes(&Struct3{OrgId: "org", Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "org", *attrVals["organization_id"].S)
+}
+
+func TestForTenantAggregates(t *testing.T) {
+	scoped, err := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{})).ForTenant("acme")
+	require.NoError(t, err)
+	fake := new(requestRecorder)
+	scoped.SetLogger(nil).AddInterceptors(fake.intercept)
+	fake.item = map[string]*dynamodb.AttributeValue{
+		"organization_id": new(dynamodb.AttributeValue).SetS("acme#org"),
+		"person_id":       new(dynamodb.AttributeValue).SetS("1"),
+	}
+
+	groups, err := scoped.AggregateQuery("", "{OrgId} = :o", "", map[string]interface{}{":o": "org"},
+		[]string{"OrgId", "Id"}, []Aggregation{Count()})
+	require.NoError(t, err)
+	assert.Equal(t, []*AggregateGroup{{Key: []interface{}{"org", "1"}, Values: []float64{1}}}, groups)
+	assert.Equal(t, "acme#org", *fake.inputs[0].(*dynamodb.QueryInput).ExpressionAttributeValues[":o"].S)
+}
+
+func TestForTenantSetsTenantField(t *testing.T) {
+	dao := newTestDao(t, "TenantUser", reflect.TypeOf(TenantUser{}))
+	scoped, err := dao.ForTenant("acme")
+	require.NoError(t, err)
+	fake := new(requestRecorder)
+	scoped.SetLogger(nil).AddInterceptors(fake.intercept)
+
+	attrVals, err := scoped.MarshalAttributes(TenantUser{Id: "1", Email: "joe@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "TENANT#acme#USER#1", *attrVals["pk"].S)
+	assert.Equal(t, "acme", *attrVals["tenant_id"].S)
+	assert.Equal(t, "acme#joe@example.com", *attrVals["email"].S)
+	_, err = scoped.MarshalAttributes(TenantUser{TenantId: "other", Id: "1"})
+	assert.EqualError(t, err, "cross-tenant access: the item belongs to tenant other")
+
+	pk, err := scoped.KeyValue("pk", &TenantUser{Id: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, "TENANT#acme#USER#1", pk)
+	fake.item = attrVals
+	page, err := scoped.Query().Key("pk").Eq(pk).Options(TotalSizeMode(TotalNone)).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{&TenantUser{TenantId: "acme", Id: "1", Email: "joe@example.com"}}, page.Data)
+	assert.Equal(t, pk, *fake.inputs[0].(*dynamodb.QueryInput).ExpressionAttributeValues[":v0"].S)
+
+	_, err = scoped.Query().Key("pk").Eq("TENANT#other#USER#1").Execute()
+	assert.EqualError(t, err, "CountQuery TenantUser: cross-tenant access: the query is of tenant \"other\"")
+	page, err = scoped.Query().Index("ByEmail").Key("email").Eq("joe@example.com").
+		Options(TotalSizeMode(TotalNone)).Execute()
+	require.NoError(t, err)
+	assert.Equal(t, "acme#joe@example.com", *fake.inputs[1].(*dynamodb.QueryInput).ExpressionAttributeValues[":v0"].S)
+
+	attrVals["tenant_id"].SetS("other")
+	_, err = scoped.UnmarshalAttributes(attrVals)
+	assert.EqualError(t, err, "cross-tenant access: the item belongs to tenant other")
+}
+
+func TestForTenantTokens(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	fake := &requestRecorder{item: map[string]*dynamodb.AttributeValue{
+		"organization_id": new(dynamodb.AttributeValue).SetS("a#org"),
+		"person_id":       new(dynamodb.AttributeValue).SetS("1"),
+	}}
+	dao.SetLogger(nil).AddInterceptors(fake.intercept)
+	a, err := dao.ForTenant("a")
+	require.NoError(t, err)
+	b, err := dao.ForTenant("b")
+	require.NoError(t, err)
+	query := func(dao *DynamoDBDao, lastItemToken *string) (*SearchPage, error) {
+		return dao.PagedQuery("", "{OrgId} = :o", "", map[string]interface{}{":o": "org"}, lastItemToken, 0, 1,
+			TotalSizeMode(TotalNone))
+	}
+
+	page, err := query(a, nil)
+	require.NoError(t, err)
+	require.NotNil(t, page.LastItemToken)
+	_, err = query(a, page.LastItemToken)
+	require.NoError(t, err)
+	// The same search of another tenant, or of no tenant, does not accept the token.
+	_, err = query(b, page.LastItemToken)
+	requireInvalidToken(t, err)
+	_, err = query(dao, page.LastItemToken)
+	requireInvalidToken(t, err)
+}
+
+func TestForTenantErrors(t *testing.T) {
+	dao := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	_, err := dao.ForTenant("")
+	assert.EqualError(t, err, "invalid tenant ID \"\": tenant IDs cannot be empty or contain \"#\"")
+	_, err = dao.ForTenant("a#b")
+	assert.EqualError(t, err, "invalid tenant ID \"a#b\": tenant IDs cannot be empty or contain \"#\"")
+	scoped, err := dao.ForTenant("acme")
+	require.NoError(t, err)
+	_, err = scoped.ForTenant("other")
+	assert.EqualError(t, err, "the DAO is already scoped to tenant acme")
+
+	_, err = newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{})).ForTenant("acme")
+	assert.EqualError(t, err, "the hash key B is not a string and cannot be scoped to a tenant")
+}
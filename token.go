@@ -0,0 +1,185 @@
+package dynamoDao
+
+import (
+	"bytes"
+	"compress/lzw"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"strings"
+)
+
+const (
+	tokenVersion = byte(1)
+
+	tokenFlagEncrypted = byte(1 << 0)
+
+	tokenHeaderSize = 2
+	tokenMACSize    = sha256.Size
+)
+
+// InvalidTokenError is returned by PagedQuery and PagedScan when a LastItemToken was not issued by a DAO with the same
+// token key, has been modified, was issued for a different table, index, query or tenant (see ForTenant), or is of an
+// unsupported version.
+type InvalidTokenError struct {
+	Reason string
+}
+
+func (e *InvalidTokenError) Error() string {
+	return "invalid last item token: " + e.Reason
+}
+
+// Sets the key used to sign (and, if enabled, encrypt) the LastItemTokens returned by PagedQuery and PagedScan.  Every
+// DAO that must accept the tokens of another, e.g. all instances of a service behind a load balancer, must use the
+// same key.  If no key is set, a random key is generated when the DAO is created so tokens are only accepted by the
+// DAO that issued them.
+func (dao *DynamoDBDao) SetTokenKey(key []byte) *DynamoDBDao {
+	dao.tokenKey = append([]byte(nil), key...)
+	return dao
+}
+
+// Sets whether the LastItemTokens are encrypted, hiding the key values of the last item from clients.  Tokens are
+// always signed.
+func (dao *DynamoDBDao) SetTokenEncryption(encrypt bool) *DynamoDBDao {
+	dao.encryptTokens = encrypt
+	return dao
+}
+
+func newTokenKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("unable to generate token key: " + err.Error())
+	}
+	return key
+}
+
+// Derives a purpose specific key from the token key so the same bytes are never used for both signing and encrypting.
+func (dao *DynamoDBDao) deriveTokenKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, dao.tokenKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// Everything a token is bound to.  A token is only accepted by a search with the same binding, of the same tenant.
+func (dao *DynamoDBDao) tokenBinding(binding []string) []byte {
+	return []byte(strings.Join(append([]string{dao.TableName, dao.TenantID()}, binding...), "\x00"))
+}
+
+func (dao *DynamoDBDao) tokenMAC(binding []string, headerAndBody []byte) []byte {
+	mac := hmac.New(sha256.New, dao.deriveTokenKey("sign"))
+	mac.Write(dao.tokenBinding(binding))
+	mac.Write([]byte{0})
+	mac.Write(headerAndBody)
+	return mac.Sum(nil)
+}
+
+func (dao *DynamoDBDao) tokenCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dao.deriveTokenKey("encrypt"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Converts the key of the last item of a page to a token: version | flags | body | HMAC-SHA256, base64 encoded.  The
+// body is the compressed JSON of the key, encrypted with AES-GCM (nonce | ciphertext) if encryption is enabled.
+func (dao *DynamoDBDao) keyToToken(binding []string, lastItemKey map[string]*dynamodb.AttributeValue) (*string, error) {
+	lastItemKeyJson, err := json.Marshal(lastItemKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := compress(lastItemKeyJson)
+	if err != nil {
+		return nil, err
+	}
+	flags := byte(0)
+	if dao.encryptTokens {
+		flags |= tokenFlagEncrypted
+		aead, err := dao.tokenCipher()
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+		body = aead.Seal(nonce, nonce, body, dao.tokenBinding(binding))
+	}
+	token := append([]byte{tokenVersion, flags}, body...)
+	token = append(token, dao.tokenMAC(binding, token)...)
+	lastItemToken := base64.RawURLEncoding.EncodeToString(token)
+	return &lastItemToken, nil
+}
+
+// Verifies the token and converts it back to the key of the last item of the previous page.  A nil token returns a nil
+// key.  Any problem with the token is reported as an *InvalidTokenError.
+func (dao *DynamoDBDao) tokenToKey(binding []string, lastItemToken *string) (map[string]*dynamodb.AttributeValue, error) {
+	if lastItemToken == nil {
+		return nil, nil
+	}
+	token, err := base64.RawURLEncoding.DecodeString(*lastItemToken)
+	if err != nil {
+		return nil, &InvalidTokenError{Reason: "malformed encoding"}
+	}
+	if len(token) < tokenHeaderSize+tokenMACSize {
+		return nil, &InvalidTokenError{Reason: "too short"}
+	}
+	if token[0] != tokenVersion {
+		return nil, &InvalidTokenError{Reason: "unsupported version"}
+	}
+	headerAndBody := token[:len(token)-tokenMACSize]
+	if !hmac.Equal(token[len(token)-tokenMACSize:], dao.tokenMAC(binding, headerAndBody)) {
+		return nil, &InvalidTokenError{Reason: "signature does not match this search"}
+	}
+	flags := token[1]
+	body := headerAndBody[tokenHeaderSize:]
+	if flags&tokenFlagEncrypted != 0 {
+		aead, err := dao.tokenCipher()
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < aead.NonceSize() {
+			return nil, &InvalidTokenError{Reason: "too short"}
+		}
+		body, err = aead.Open(nil, body[:aead.NonceSize()], body[aead.NonceSize():], dao.tokenBinding(binding))
+		if err != nil {
+			return nil, &InvalidTokenError{Reason: "unable to decrypt"}
+		}
+	}
+	lastItemKeyJson, err := decompress(body)
+	if err != nil {
+		return nil, &InvalidTokenError{Reason: "malformed body"}
+	}
+	var lastItemKey map[string]*dynamodb.AttributeValue
+	if err := json.Unmarshal(lastItemKeyJson, &lastItemKey); err != nil {
+		return nil, &InvalidTokenError{Reason: "malformed key"}
+	}
+	return lastItemKey, nil
+}
+
+func decompress(in []byte) ([]byte, error) {
+	lzwReader := lzw.NewReader(bytes.NewReader(in), lzw.LSB, 8)
+	defer lzwReader.Close()
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(lzwReader); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func compress(in []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	lzwWriter := lzw.NewWriter(buf, lzw.LSB, 8)
+	if _, err := lzwWriter.Write(in); err != nil {
+		return nil, err
+	}
+	if err := lzwWriter.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package dynamoDao
+
+import (
+	"encoding/base64"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+var testLastItemKey = map[string]*dynamodb.AttributeValue{
+	"a": {S: aws.String("3")},
+	"B": {N: aws.String("-55")},
+}
+
+func requireInvalidToken(t *testing.T, err error) {
+	require.Error(t, err)
+	_, ok := err.(*InvalidTokenError)
+	assert.True(t, ok, "expected *InvalidTokenError but got %T: %v", err, err)
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+	binding := []string{"query", "Foo", "{a} = :a", ""}
+
+	token, err := dao.keyToToken(binding, testLastItemKey)
+	require.NoError(t, err)
+	require.NotNil(t, token)
+	key, err := dao.tokenToKey(binding, token)
+	require.NoError(t, err)
+	assert.Equal(t, testLastItemKey, key)
+
+	key, err = dao.tokenToKey(binding, nil)
+	require.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+func TestEncryptedTokenRoundTrip(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{})).SetTokenKey([]byte("secret")).
+		SetTokenEncryption(true)
+	binding := []string{"scan", "Foo"}
+
+	token, err := dao.keyToToken(binding, testLastItemKey)
+	require.NoError(t, err)
+	raw, err := base64.RawURLEncoding.DecodeString(*token)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "-55")
+
+	key, err := dao.tokenToKey(binding, token)
+	require.NoError(t, err)
+	assert.Equal(t, testLastItemKey, key)
+
+	other := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{})).SetTokenKey([]byte("secret"))
+	key, err = other.tokenToKey(binding, token)
+	require.NoError(t, err)
+	assert.Equal(t, testLastItemKey, key)
+}
+
+func TestInvalidTokens(t *testing.T) {
+	dao := newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{}))
+	binding := []string{"query", "Foo", "{a} = :a", ""}
+	token, err := dao.keyToToken(binding, testLastItemKey)
+	require.NoError(t, err)
+
+	_, err = dao.tokenToKey([]string{"query", "", "{a} = :a", ""}, token)
+	requireInvalidToken(t, err)
+	_, err = dao.tokenToKey([]string{"query", "Foo", "{a} = :a", "{n} = :n"}, token)
+	requireInvalidToken(t, err)
+	_, err = newTestDao(t, "TestStruct", reflect.TypeOf(TestStruct{})).tokenToKey(binding, token)
+	requireInvalidToken(t, err)
+
+	raw, err := base64.RawURLEncoding.DecodeString(*token)
+	require.NoError(t, err)
+	tampered := append([]byte(nil), raw...)
+	tampered[3] ^= 0xff
+	_, err = dao.tokenToKey(binding, aws.String(base64.RawURLEncoding.EncodeToString(tampered)))
+	requireInvalidToken(t, err)
+	unversioned := append([]byte(nil), raw...)
+	unversioned[0] = 0
+	_, err = dao.tokenToKey(binding, aws.String(base64.RawURLEncoding.EncodeToString(unversioned)))
+	requireInvalidToken(t, err)
+
+	_, err = dao.tokenToKey(binding, aws.String("not a token!"))
+	requireInvalidToken(t, err)
+	_, err = dao.tokenToKey(binding, aws.String("AAAA"))
+	requireInvalidToken(t, err)
+}
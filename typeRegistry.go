@@ -0,0 +1,157 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"reflect"
+)
+
+const typeTag = "dynamoType"
+
+// A struct type registered with a DAO to be stored in the same table as the DAO's type and told apart from it by the
+// value of the discriminator attribute.
+type registeredType struct {
+	structType    reflect.Type
+	discriminator string
+	keyTemplates  []*keyTemplate
+	deletedAt     *deletedAtField
+}
+
+// Sets the name of the discriminator attribute used to tell the types registered with the DAO (see RegisterType)
+// apart.  It need not be set if the registered types have a field tagged with dynamoType, in which case it is the
+// attribute of that field.  It must be set before types are registered.
+func (dao *DynamoDBDao) SetTypeAttribute(attrName string) *DynamoDBDao {
+	dao.typeAttribute = attrName
+	return dao
+}
+
+// Returns the name of the discriminator attribute, empty if no types are registered.
+func (dao *DynamoDBDao) TypeAttribute() string {
+	return dao.typeAttribute
+}
+
+// Registers a struct type to be stored in the DAO's table alongside the DAO's own type, e.g. orders in the table of
+// users, identified by the given value of the discriminator attribute (see SetTypeAttribute).  Items of a registered
+// type can be written with PutItem and UpdateItem, which stamp the discriminator on them, and every read returns an
+// item whose discriminator is registered as a pointer to its registered type.  Items without a discriminator, or with
+// one that is not registered, are read as the DAO's type.
+//
+// The discriminator may instead be given by tagging a string field of the type with it, e.g.
+//
+//	Kind string `dynamodbav:"type" dynamoType:"ORDER"`
+//
+// in which case the field's attribute is the discriminator attribute and the discriminator passed may be empty.  If the
+// DAO's own type has such a field it is registered when the DAO is created.  The key attributes of a registered type,
+// usually built from key templates (e.g. pk=ORDER#{Id}), must be those of the table.  A registered type is soft
+// deleted (see DeleteItem) if it has a dynamoDeletedAt field, which must be stored in the same attribute as that of
+// the DAO's type; items of the types that don't have one are deleted for good.  Types must be registered before the
+// DAO is used.
+func (dao *DynamoDBDao) RegisterType(structType reflect.Type, discriminator string) error {
+	typeAttribute := dao.typeAttribute
+	if structType.Kind() != reflect.Struct {
+		return errors.New("cannot register " + structType.String() + ": not a struct")
+	}
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		tagged, ok := field.Tag.Lookup(typeTag)
+		if !ok {
+			continue
+		}
+		attrName := getFieldName("", field)
+		switch {
+		case field.Type.Kind() != reflect.String || attrName == "-":
+			return fmt.Errorf("cannot register %s: the %s field %s must be a stored string", structType, typeTag,
+				field.Name)
+		case discriminator != "" && discriminator != tagged:
+			return fmt.Errorf("cannot register %s as %s: it is tagged as %s", structType, discriminator, tagged)
+		case typeAttribute != "" && typeAttribute != attrName:
+			return fmt.Errorf("cannot register %s: its discriminator attribute is %s, not %s", structType, attrName,
+				typeAttribute)
+		}
+		discriminator = tagged
+		typeAttribute = attrName
+	}
+	if discriminator == "" {
+		return errors.New("cannot register " + structType.String() + ": no discriminator")
+	}
+	if typeAttribute == "" {
+		return errors.New("cannot register " + structType.String() +
+			": no discriminator attribute, set one with SetTypeAttribute")
+	}
+	if existing, ok := dao.types[discriminator]; ok && existing.structType != structType {
+		return fmt.Errorf("cannot register %s as %s: %s is", structType, discriminator, existing.structType)
+	}
+	if existing := dao.registeredType(structType); existing != nil && existing.discriminator != discriminator {
+		return fmt.Errorf("cannot register %s as %s: it is registered as %s", structType, discriminator,
+			existing.discriminator)
+	}
+	if _, err := rulesFor(structType); err != nil {
+		return err
+	}
+	keyTemplates, err := keyTemplatesForType(structType)
+	if err != nil {
+		return err
+	}
+	deletedAt, err := deletedAtFieldFor(structType)
+	if err != nil {
+		return err
+	}
+	if deletedAt != nil && (dao.deletedAt == nil || dao.deletedAt.attrName != deletedAt.attrName) {
+		return fmt.Errorf("cannot register %s: its %s attribute %s is not that of %s", structType, deletedAtTag,
+			deletedAt.attrName, dao.structType)
+	}
+	dao.typeAttribute = typeAttribute
+	if dao.types == nil {
+		dao.types = make(map[string]*registeredType)
+	}
+	dao.types[discriminator] = &registeredType{
+		structType:    structType,
+		discriminator: discriminator,
+		keyTemplates:  keyTemplates,
+		deletedAt:     deletedAt,
+	}
+	return nil
+}
+
+// Returns whether a field of the struct type is tagged with dynamoType.
+func typeTagged(structType reflect.Type) bool {
+	for f := 0; f < structType.NumField(); f++ {
+		if _, ok := structType.Field(f).Tag.Lookup(typeTag); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the registration of the struct type, nil if it isn't registered.
+func (dao *DynamoDBDao) registeredType(structType reflect.Type) *registeredType {
+	for _, rt := range dao.types {
+		if rt.structType == structType {
+			return rt
+		}
+	}
+	return nil
+}
+
+// Returns the type the attributes are unmarshaled into: the registered type named by the discriminator attribute, or
+// the DAO's type.
+func (dao *DynamoDBDao) itemType(attributes map[string]*dynamodb.AttributeValue) reflect.Type {
+	if attrVal, ok := attributes[dao.typeAttribute]; ok && attrVal.S != nil {
+		if rt, ok := dao.types[*attrVal.S]; ok {
+			return rt.structType
+		}
+	}
+	return dao.structType
+}
+
+// Sets the discriminator attribute of an item of a registered type.
+func (dao *DynamoDBDao) stampType(item interface{}, attrVals map[string]*dynamodb.AttributeValue) {
+	value, _, ok := dao.structValue(item)
+	if !ok {
+		return
+	}
+	if rt := dao.registeredType(value.Type()); rt != nil {
+		attrVals[dao.typeAttribute] = new(dynamodb.AttributeValue).SetS(rt.discriminator)
+	}
+}
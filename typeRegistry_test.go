@@ -0,0 +1,145 @@
+package dynamoDao
+
+import (
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type PolyUser struct {
+	Kind string `dynamodbav:"type" dynamoType:"USER"`
+	Id   string `dynamodbav:"id" dynamoKey:"hash,pk=USER#{Id}"`
+	Name string `dynamodbav:"name" dynamoKey:"range,sk=PROFILE#{Id}"`
+}
+
+type PolyOrder struct {
+	Kind    string `dynamodbav:"type" dynamoType:"ORDER"`
+	UserId  string `dynamodbav:"user_id" dynamoKey:"hash,pk=USER#{UserId}"`
+	OrderId string `dynamodbav:"order_id" dynamoKey:"range,sk=ORDER#{OrderId}"`
+	Total   int    `dynamodbav:"total"`
+}
+
+type PolyNote struct {
+	UserId string `dynamodbav:"-" dynamoKey:"hash,pk=USER#{UserId}"`
+	NoteId string `dynamodbav:"-" dynamoKey:"range,sk=NOTE#{NoteId}"`
+	Text   string `dynamodbav:"text"`
+}
+
+func newPolyDao(t *testing.T) *DynamoDBDao {
+	dao := newTestDao(t, "Poly", reflect.TypeOf(PolyUser{}))
+	require.NoError(t, dao.RegisterType(reflect.TypeOf(PolyOrder{}), ""))
+	require.NoError(t, dao.RegisterType(reflect.TypeOf(PolyNote{}), "NOTE"))
+	return dao
+}
+
+func TestRegisterType(t *testing.T) {
+	dao := newPolyDao(t)
+	assert.Equal(t, "type", dao.TypeAttribute())
+	assert.Equal(t, 3, len(dao.types))
+	assert.Equal(t, reflect.TypeOf(PolyUser{}), dao.types["USER"].structType)
+
+	// Registering a type again is harmless.
+	assert.NoError(t, dao.RegisterType(reflect.TypeOf(PolyOrder{}), "ORDER"))
+	assert.EqualError(t, dao.RegisterType(reflect.TypeOf(PolyOrder{}), "SALE"),
+		"cannot register dynamoDao.PolyOrder as SALE: it is tagged as ORDER")
+	assert.EqualError(t, dao.RegisterType(reflect.TypeOf(PolyNote{}), "ORDER"),
+		"cannot register dynamoDao.PolyNote as ORDER: dynamoDao.PolyOrder is")
+	assert.EqualError(t, dao.RegisterType(reflect.TypeOf(PolyNote{}), "MEMO"),
+		"cannot register dynamoDao.PolyNote as MEMO: it is registered as NOTE")
+	assert.EqualError(t, dao.RegisterType(reflect.TypeOf(""), "X"), "cannot register string: not a struct")
+
+	untyped := newTestDao(t, "Struct3", reflect.TypeOf(Struct3{}))
+	assert.EqualError(t, untyped.RegisterType(reflect.TypeOf(PolyNote{}), "NOTE"),
+		"cannot register dynamoDao.PolyNote: no discriminator attribute, set one with SetTypeAttribute")
+	assert.NoError(t, untyped.SetTypeAttribute("kind").RegisterType(reflect.TypeOf(PolyNote{}), "NOTE"))
+	assert.EqualError(t, untyped.RegisterType(reflect.TypeOf(PolyOrder{}), ""),
+		"cannot register dynamoDao.PolyOrder: its discriminator attribute is type, not kind")
+}
+
+func TestPolymorphicWritesAndReads(t *testing.T) {
+	dao := newPolyDao(t)
+	var written map[string]*dynamodb.AttributeValue
+	dao.SetLogger(nil).AddInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+		switch input := request.Input.(type) {
+		case *dynamodb.PutItemInput:
+			written = input.Item
+			return new(dynamodb.PutItemOutput), nil
+		case *dynamodb.QueryInput:
+			order, _ := dao.MarshalAttributes(&PolyOrder{UserId: "joe", OrderId: "o-1", Total: 10})
+			note, _ := dao.MarshalAttributes(&PolyNote{UserId: "joe", NoteId: "n-1", Text: "hi"})
+			user, _ := dao.MarshalAttributes(&PolyUser{Id: "joe", Name: "Joe"})
+			return new(dynamodb.QueryOutput).SetItems([]map[string]*dynamodb.AttributeValue{user, order, note}), nil
+		}
+		return nil, nil
+	})
+
+	_, err := dao.PutItem(PolyOrder{UserId: "joe", OrderId: "o-1", Total: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "ORDER", *written["type"].S)
+	assert.Equal(t, "USER#joe", *written["pk"].S)
+	assert.Equal(t, "ORDER#o-1", *written["sk"].S)
+	_, err = dao.PutItem(&PolyNote{UserId: "joe", NoteId: "n-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "NOTE", *written["type"].S)
+
+	page, err := dao.Query().Key("pk").Eq("USER#joe").Filter("Total").Ge(0).Filter("type").Ne("X").
+		Options(TotalSizeMode(TotalNone)).Execute()
+	require.NoError(t, err)
+	require.Equal(t, 3, len(page.Data))
+	assert.Equal(t, &PolyUser{Kind: "USER", Id: "joe", Name: "Joe"}, page.Data[0])
+	assert.Equal(t, &PolyOrder{Kind: "ORDER", UserId: "joe", OrderId: "o-1", Total: 10}, page.Data[1])
+	assert.Equal(t, &PolyNote{UserId: "joe", NoteId: "n-1", Text: "hi"}, page.Data[2])
+
+	// Items with an unknown discriminator are read as the DAO's type.
+	attrVals, err := dao.MarshalAttributes(&PolyUser{Id: "joe"})
+	require.NoError(t, err)
+	attrVals["type"].SetS("INVOICE")
+	item, err := dao.UnmarshalAttributes(attrVals)
+	require.NoError(t, err)
+	assert.IsType(t, &PolyUser{}, item)
+}
+
+func TestPolymorphicProjection(t *testing.T) {
+	dao := newPolyDao(t)
+	rec := &requestRecorder{}
+	dao.SetLogger(nil).AddInterceptors(func(request *Request, next func() (interface{}, error)) (interface{}, error) {
+		rec.inputs = append(rec.inputs, request.Input)
+		query := request.Input.(*dynamodb.QueryInput)
+		// The table only returns the projected attributes.
+		projected := make(map[string]bool)
+		for _, alias := range strings.Split(*query.ProjectionExpression, ", ") {
+			projected[*query.ExpressionAttributeNames[alias]] = true
+		}
+		var items []map[string]*dynamodb.AttributeValue
+		for _, item := range []interface{}{&PolyUser{Id: "joe", Name: "Joe"},
+			&PolyOrder{UserId: "joe", OrderId: "o-1", Total: 10}} {
+			attrVals, _ := dao.MarshalAttributes(item)
+			for attrName := range attrVals {
+				if !projected[attrName] {
+					delete(attrVals, attrName)
+				}
+			}
+			items = append(items, attrVals)
+		}
+		return new(dynamodb.QueryOutput).SetItems(items), nil
+	})
+
+	page, err := dao.Query().Key("pk").Eq("USER#joe").
+		Options(ProjectFields("Id", "UserId"), TotalSizeMode(TotalNone)).Execute()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(rec.inputs))
+	var projected []string
+	for _, attrName := range rec.inputs[0].(*dynamodb.QueryInput).ExpressionAttributeNames {
+		projected = append(projected, *attrName)
+	}
+	assert.Contains(t, projected, "type")
+	require.Equal(t, 2, len(page.Data))
+	assert.IsType(t, &PolyUser{}, page.Data[0])
+	assert.Equal(t, "joe", page.Data[0].(*PolyUser).Id)
+	assert.IsType(t, &PolyOrder{}, page.Data[1])
+	assert.Equal(t, "joe", page.Data[1].(*PolyOrder).UserId)
+	assert.Equal(t, 0, page.Data[1].(*PolyOrder).Total)
+}
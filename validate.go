@@ -0,0 +1,342 @@
+package dynamoDao
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	ValidateRequired = "required"
+	ValidateMinLen   = "minLen"
+	ValidateMaxLen   = "maxLen"
+	ValidateMin      = "min"
+	ValidateMax      = "max"
+	ValidateRegex    = "regex"
+	ValidateEnum     = "enum"
+	// The rule reported for an error returned by a Validator.
+	ValidateCustom = "custom"
+)
+
+// Validator is implemented by item types with checks that cannot be expressed with dynamoValidate tags.  Validate is
+// called after the tags have been checked.  If it returns a *ValidationError its violations are added to those of the
+// tags, any other error is reported as a violation of the custom rule.
+type Validator interface {
+	Validate() error
+}
+
+// FieldViolation is a rule a field of an item does not satisfy.  Field is the attribute path of the field, e.g.
+// address.city or lines[2].amount, and empty for a custom violation of the whole item.
+type FieldViolation struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// ValidationError is returned by PutItem, UpdateItem and Validate when an item does not satisfy its dynamoValidate
+// tags or its Validate method.  It lists every violation, not just the first.
+type ValidationError struct {
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		if violation.Field == "" {
+			messages[i] = violation.Message
+		} else {
+			messages[i] = violation.Field + " " + violation.Message
+		}
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// The rules of a field parsed from its dynamoValidate tag.
+type fieldRules struct {
+	index    int
+	attrName string
+	inline   bool
+	required bool
+	minLen   *int
+	maxLen   *int
+	min      *float64
+	max      *float64
+	regex    *regexp.Regexp
+	enum     []string
+}
+
+var (
+	// The rules of each struct type, parsed the first time it is validated.
+	validationRules sync.Map
+)
+
+// Validate checks the item against the dynamoValidate tags of its fields and its Validate method, returning a
+// *ValidationError listing every violation.  PutItem and UpdateItem call it before writing an item.
+//
+// The tag holds a comma separated list of rules:
+//
+//	required        the field must not be empty: zero for scalars, nil for pointers, and no elements for strings,
+//	                slices and maps
+//	minLen=n        strings must have at least n characters, slices and maps at least n elements
+//	maxLen=n        strings must have at most n characters, slices and maps at most n elements
+//	min=x, max=x    numbers must be at least or at most x
+//	enum=a|b|c      the value must be one of those listed
+//	regex=re        strings must match the regular expression, which must be the last rule as it may contain commas
+//
+// The rules other than required are not applied to nil pointers and empty strings.  The fields of nested structs,
+// including those in slices, are validated as well.
+func Validate(item interface{}) error {
+	value := reflect.ValueOf(item)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return errors.New("cannot validate a nil item")
+		}
+		value = value.Elem()
+	}
+	violations := make([]FieldViolation, 0)
+	if value.Kind() == reflect.Struct {
+		if err := validateStruct(value, "", &violations); err != nil {
+			return err
+		}
+	}
+	if validator, ok := hookTarget(item).(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			if validationErr, ok := err.(*ValidationError); ok {
+				violations = append(violations, validationErr.Violations...)
+			} else {
+				violations = append(violations, FieldViolation{Rule: ValidateCustom, Message: err.Error()})
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+	return nil
+}
+
+func validateStruct(value reflect.Value, prefix string, violations *[]FieldViolation) error {
+	rules, err := rulesFor(value.Type())
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		field := value.Field(rule.index)
+		if rule.inline {
+			if field = derefValue(field); field.IsValid() {
+				if err := validateStruct(field, prefix, violations); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		attrPath := prefix + rule.attrName
+		rule.check(field, attrPath, violations)
+		if err := validateNested(derefValue(field), attrPath, violations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validates the structs in the field's value, if there are any.
+func validateNested(value reflect.Value, attrPath string, violations *[]FieldViolation) error {
+	if !value.IsValid() {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Struct:
+		if mapToScalarType(value.Type()) == "" {
+			return validateStruct(value, attrPath+".", violations)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := validateNested(derefValue(value.Index(i)), fmt.Sprintf("%s[%d]", attrPath, i),
+				violations); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func derefValue(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+func (rules *fieldRules) check(field reflect.Value, attrPath string, violations *[]FieldViolation) {
+	violate := func(rule, message string, args ...interface{}) {
+		*violations = append(*violations, FieldViolation{Field: attrPath, Rule: rule, Message: fmt.Sprintf(message, args...)})
+	}
+	value := derefValue(field)
+	empty := !value.IsValid()
+	length := -1
+	if !empty {
+		switch value.Kind() {
+		case reflect.String:
+			length = utf8.RuneCountInString(value.String())
+			empty = length == 0
+		case reflect.Slice, reflect.Map, reflect.Array:
+			length = value.Len()
+			empty = length == 0
+		default:
+			empty = value.IsZero()
+		}
+	}
+	if rules.required && empty {
+		violate(ValidateRequired, "is required")
+	}
+	if !value.IsValid() || value.Kind() == reflect.String && length == 0 {
+		return
+	}
+	if rules.minLen != nil && length >= 0 && length < *rules.minLen {
+		violate(ValidateMinLen, "must have a length of at least %d", *rules.minLen)
+	}
+	if rules.maxLen != nil && length >= 0 && length > *rules.maxLen {
+		violate(ValidateMaxLen, "must have a length of at most %d", *rules.maxLen)
+	}
+	if number, ok := numberValue(value); ok {
+		if rules.min != nil && number < *rules.min {
+			violate(ValidateMin, "must be at least %v", *rules.min)
+		}
+		if rules.max != nil && number > *rules.max {
+			violate(ValidateMax, "must be at most %v", *rules.max)
+		}
+	}
+	if rules.regex != nil && value.Kind() == reflect.String && !rules.regex.MatchString(value.String()) {
+		violate(ValidateRegex, "must match %s", rules.regex.String())
+	}
+	if len(rules.enum) > 0 {
+		text := fmt.Sprint(value.Interface())
+		found := false
+		for _, allowed := range rules.enum {
+			found = found || allowed == text
+		}
+		if !found {
+			violate(ValidateEnum, "must be one of %s", strings.Join(rules.enum, ", "))
+		}
+	}
+}
+
+func numberValue(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+	return 0, false
+}
+
+// Returns the rules of the fields of the struct type that have any, or that may contain structs with rules.
+func rulesFor(structType reflect.Type) ([]*fieldRules, error) {
+	if rules, ok := validationRules.Load(structType); ok {
+		return rules.([]*fieldRules), nil
+	}
+	rules := make([]*fieldRules, 0)
+	for f := 0; f < structType.NumField(); f++ {
+		field := structType.Field(f)
+		attrName := getFieldName("", field)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		inline := field.Anonymous && attrName == field.Name && fieldType.Kind() == reflect.Struct
+		// The values of unexported fields cannot be read, only the exported fields of embedded structs can.
+		if attrName == "-" || field.PkgPath != "" && !inline {
+			continue
+		}
+		if inline {
+			rules = append(rules, &fieldRules{index: f, inline: true})
+			continue
+		}
+		rule, err := parseValidateTag(field)
+		if err != nil {
+			return nil, err
+		}
+		rule.index, rule.attrName = f, attrName
+		rules = append(rules, rule)
+	}
+	validationRules.Store(structType, rules)
+	return rules, nil
+}
+
+func parseValidateTag(field reflect.StructField) (*fieldRules, error) {
+	rules := &fieldRules{}
+	tag, ok := field.Tag.Lookup("dynamoValidate")
+	if !ok || tag == "" {
+		return rules, nil
+	}
+	invalid := func(reason string) error {
+		return fmt.Errorf("invalid dynamoValidate tag on field %s: %s", field.Name, reason)
+	}
+	for tag != "" {
+		rule := tag
+		if strings.HasPrefix(tag, ValidateRegex+"=") {
+			tag = ""
+		} else if comma := strings.Index(tag, ","); comma >= 0 {
+			rule, tag = tag[:comma], tag[comma+1:]
+		} else {
+			tag = ""
+		}
+		name, arg := rule, ""
+		if equals := strings.Index(rule, "="); equals >= 0 {
+			name, arg = rule[:equals], rule[equals+1:]
+		}
+		switch name {
+		case ValidateRequired:
+			rules.required = true
+		case ValidateMinLen, ValidateMaxLen:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return nil, invalid(name + " requires a length")
+			}
+			if name == ValidateMinLen {
+				rules.minLen = &n
+			} else {
+				rules.maxLen = &n
+			}
+		case ValidateMin, ValidateMax:
+			x, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return nil, invalid(name + " requires a number")
+			}
+			if name == ValidateMin {
+				rules.min = &x
+			} else {
+				rules.max = &x
+			}
+		case ValidateRegex:
+			regex, err := regexp.Compile(arg)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			rules.regex = regex
+		case ValidateEnum:
+			if arg == "" {
+				return nil, invalid("enum requires values")
+			}
+			rules.enum = strings.Split(arg, "|")
+		default:
+			return nil, invalid("unknown rule " + name)
+		}
+	}
+	return rules, nil
+}
+
+// Validates the item as PutItem and UpdateItem do.  See Validate.
+func (dao *DynamoDBDao) Validate(item interface{}) error {
+	return Validate(item)
+}
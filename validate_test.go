@@ -0,0 +1,128 @@
+package dynamoDao
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"reflect"
+	"testing"
+)
+
+type ValidatedLine struct {
+	Sku      string `dynamodbav:"sku" dynamoValidate:"required"`
+	Quantity int    `dynamodbav:"quantity" dynamoValidate:"min=1,max=99"`
+}
+
+type ValidatedAudit struct {
+	CreatedBy string `dynamodbav:"created_by" dynamoValidate:"required"`
+}
+
+type ValidatedStruct struct {
+	ValidatedAudit
+	Id       string          `dynamodbav:"id" dynamoKey:"hash" dynamoValidate:"required"`
+	Name     string          `dynamodbav:"name" dynamoValidate:"minLen=3,maxLen=8"`
+	Email    string          `dynamodbav:"email" dynamoValidate:"regex=^[^@,]+@[^@,]+$"`
+	Status   string          `dynamodbav:"status" dynamoValidate:"required,enum=open|closed"`
+	Score    *float64        `dynamodbav:"score" dynamoValidate:"min=0,max=1"`
+	Tags     []string        `dynamodbav:"tags" dynamoValidate:"maxLen=2"`
+	Lines    []ValidatedLine `dynamodbav:"lines"`
+	Shipping *ValidatedLine  `dynamodbav:"shipping"`
+	Closed   bool            `dynamodbav:"-"`
+}
+
+func (v *ValidatedStruct) Validate() error {
+	if v.Closed && v.Status != "closed" {
+		return errors.New("a closed item must have the closed status")
+	}
+	return nil
+}
+
+type InvalidTagStruct struct {
+	Id string `dynamodbav:"id" dynamoKey:"hash" dynamoValidate:"minLen=x"`
+}
+
+func TestValidate(t *testing.T) {
+	score := 0.5
+	valid := ValidatedStruct{
+		ValidatedAudit: ValidatedAudit{CreatedBy: "joe"},
+		Id:             "1",
+		Name:           "Joe",
+		Email:          "joe@example.com",
+		Status:         "open",
+		Score:          &score,
+		Tags:           []string{"a"},
+		Lines:          []ValidatedLine{{Sku: "A", Quantity: 1}},
+	}
+	assert.NoError(t, Validate(valid))
+	assert.NoError(t, Validate(&valid))
+
+	// Optional fields are not checked when empty.
+	valid.Name, valid.Email, valid.Score = "", "", nil
+	assert.NoError(t, Validate(valid))
+
+	score = 2
+	invalid := ValidatedStruct{
+		Name:     "Jo",
+		Email:    "joe",
+		Status:   "pending",
+		Score:    &score,
+		Tags:     []string{"a", "b", "c"},
+		Lines:    []ValidatedLine{{Sku: "A", Quantity: 1}, {Quantity: 100}},
+		Shipping: &ValidatedLine{Sku: "S"},
+		Closed:   true,
+	}
+	err := Validate(invalid)
+	require.IsType(t, &ValidationError{}, err)
+	assert.Equal(t, []FieldViolation{
+		{Field: "created_by", Rule: ValidateRequired, Message: "is required"},
+		{Field: "id", Rule: ValidateRequired, Message: "is required"},
+		{Field: "name", Rule: ValidateMinLen, Message: "must have a length of at least 3"},
+		{Field: "email", Rule: ValidateRegex, Message: "must match ^[^@,]+@[^@,]+$"},
+		{Field: "status", Rule: ValidateEnum, Message: "must be one of open, closed"},
+		{Field: "score", Rule: ValidateMax, Message: "must be at most 1"},
+		{Field: "tags", Rule: ValidateMaxLen, Message: "must have a length of at most 2"},
+		{Field: "lines[1].sku", Rule: ValidateRequired, Message: "is required"},
+		{Field: "lines[1].quantity", Rule: ValidateMax, Message: "must be at most 99"},
+		{Field: "shipping.quantity", Rule: ValidateMin, Message: "must be at least 1"},
+		{Rule: ValidateCustom, Message: "a closed item must have the closed status"},
+	}, err.(*ValidationError).Violations)
+	assert.Contains(t, err.Error(), "validation failed: created_by is required; id is required; ")
+
+	_, err = rulesFor(reflect.TypeOf(InvalidTagStruct{}))
+	assert.EqualError(t, err, "invalid dynamoValidate tag on field Id: minLen requires a length")
+}
+
+type validatedStatus string
+
+type validatedTrail struct {
+	UpdatedBy string `dynamodbav:"updated_by" dynamoValidate:"required"`
+}
+
+type UnexportedEmbedStruct struct {
+	validatedStatus `dynamoValidate:"enum=a|b"`
+	validatedTrail
+	Id string `dynamodbav:"id" dynamoKey:"hash"`
+}
+
+func TestValidateUnexportedEmbeds(t *testing.T) {
+	// An unexported embedded struct is checked, any other unexported embedded type is not as it cannot be read.
+	err := Validate(UnexportedEmbedStruct{validatedStatus: "c", Id: "1"})
+	require.IsType(t, &ValidationError{}, err)
+	assert.Equal(t, []FieldViolation{{Field: "updated_by", Rule: ValidateRequired, Message: "is required"}},
+		err.(*ValidationError).Violations)
+	assert.NoError(t, Validate(&UnexportedEmbedStruct{validatedStatus: "c", validatedTrail: validatedTrail{"joe"}}))
+}
+
+func TestValidateOnWrite(t *testing.T) {
+	dao := newTestDao(t, "ValidatedStruct", reflect.TypeOf(ValidatedStruct{}))
+
+	_, err := dao.PutItem(ValidatedStruct{Id: "1", Status: "open"})
+	assert.EqualError(t, err, "PutItem ValidatedStruct: validation failed: created_by is required")
+	_, err = dao.UpdateItem(&ValidatedStruct{ValidatedAudit: ValidatedAudit{CreatedBy: "joe"}, Id: "1"})
+	assert.EqualError(t, err, "UpdateItem ValidatedStruct: validation failed: status is required")
+
+	_, err = NewDynamoDBDao(session.New(awsConfig), "InvalidTagStruct", 0, 0, false, "",
+		reflect.TypeOf(InvalidTagStruct{}))
+	assert.EqualError(t, err, "invalid dynamoValidate tag on field Id: minLen requires a length")
+}